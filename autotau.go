@@ -0,0 +1,116 @@
+package colidr
+
+import "gocv.io/x/gocv"
+
+// The supported automatic Tau selection modes.
+const (
+	// AutoTauDensity chooses Tau in such way to obtain the requested percentage of ink pixels.
+	AutoTauDensity = "density"
+	// AutoTauOtsu chooses Tau using Otsu's method on the FDoG histogram.
+	AutoTauOtsu = "otsu"
+)
+
+// histogramBins is the number of bins used for the FDoG histogram.
+// Since the meaningful Tau values are very close to 1.0 a fine grained histogram is needed.
+const histogramBins = 4096
+
+// Metadata holds the values computed during the line drawing generation.
+type Metadata struct {
+	// Tau is the threshold value used for the binarization,
+	// either the provided one or the automatically chosen one.
+	Tau float32
+	// RemovedComponents is the number of connected components removed by the cleanup stage.
+	RemovedComponents int
+}
+
+// Metadata returns the values computed during the last line drawing generation.
+func (c *Cld) Metadata() Metadata {
+	return c.meta
+}
+
+// autoTau selects the threshold value based on the FDoG histogram, using the requested mode.
+func (c *Cld) autoTau(fDog *gocv.Mat) float32 {
+	hist, total := fDogHistogram(fDog)
+	if total == 0 {
+		return c.Tau
+	}
+
+	switch c.AutoTau {
+	case AutoTauDensity:
+		return densityThreshold(hist, total, c.InkDensity/100.0)
+	case AutoTauOtsu:
+		return otsuThreshold(hist, total)
+	}
+	return c.Tau
+}
+
+// fDogHistogram computes the histogram of the normalized FDoG matrix.
+func fDogHistogram(fDog *gocv.Mat) ([]int, int) {
+	hist := make([]int, histogramBins)
+
+	data, err := fDog.DataPtrFloat32()
+	if err != nil {
+		return hist, 0
+	}
+	for _, v := range data {
+		bin := int(v * histogramBins)
+		if bin < 0 {
+			bin = 0
+		} else if bin >= histogramBins {
+			bin = histogramBins - 1
+		}
+		hist[bin]++
+	}
+	return hist, len(data)
+}
+
+// densityThreshold returns the lowest threshold for which the ratio of
+// the pixels below it (the ink pixels) reaches the requested density.
+func densityThreshold(hist []int, total int, density float64) float32 {
+	target := int(density * float64(total))
+
+	var sum int
+	for i, n := range hist {
+		sum += n
+		if sum >= target {
+			return float32(i+1) / histogramBins
+		}
+	}
+	return 1.0
+}
+
+// otsuThreshold returns the threshold which maximizes the between-class variance of the histogram.
+// See https://en.wikipedia.org/wiki/Otsu%27s_method
+func otsuThreshold(hist []int, total int) float32 {
+	var sum float64
+	for i, n := range hist {
+		sum += float64(i) * float64(n)
+	}
+
+	var (
+		sumB, maxVar float64
+		weightB      int
+		threshold    int
+	)
+	for i, n := range hist {
+		weightB += n
+		if weightB == 0 {
+			continue
+		}
+		weightF := total - weightB
+		if weightF == 0 {
+			break
+		}
+		sumB += float64(i) * float64(n)
+
+		meanB := sumB / float64(weightB)
+		meanF := (sum - sumB) / float64(weightF)
+		variance := float64(weightB) * float64(weightF) * (meanB - meanF) * (meanB - meanF)
+
+		if variance > maxVar {
+			maxVar = variance
+			threshold = i
+		}
+	}
+	return float32(threshold+1) / histogramBins
+}
@@ -0,0 +1,49 @@
+package colidr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOtsuThreshold(t *testing.T) {
+	// A bimodal histogram with modes around 0.25 and 0.75.
+	hist := make([]int, histogramBins)
+	for _, mode := range []int{histogramBins / 4, 3 * histogramBins / 4} {
+		for d := -100; d <= 100; d++ {
+			hist[mode+d] = 101 - absInt(d)
+		}
+	}
+	var total int
+	for _, n := range hist {
+		total += n
+	}
+
+	lo, hi := float32(histogramBins/4+100)/histogramBins, float32(3*histogramBins/4-100)/histogramBins
+	if tau := otsuThreshold(hist, total); tau <= lo || tau > hi {
+		t.Errorf("expected the Otsu threshold between the modes (%v, %v], got %v", lo, hi, tau)
+	}
+}
+
+func TestDensityThreshold(t *testing.T) {
+	// A uniform histogram, so the ink ratio grows linearly with the threshold.
+	hist := make([]int, histogramBins)
+	for i := range hist {
+		hist[i] = 3
+	}
+	total := 3 * histogramBins
+
+	for _, density := range []float64{0.05, 0.1, 0.5} {
+		tau := densityThreshold(hist, total, density)
+
+		var ink int
+		for i := 0; i < int(tau*histogramBins); i++ {
+			ink += hist[i]
+		}
+		if diff := math.Abs(float64(ink)/float64(total) - density); diff > 1.0/histogramBins {
+			t.Errorf("density %v: expected the ink ratio within one bin, got %v", density, float64(ink)/float64(total))
+		}
+	}
+	if tau := densityThreshold(hist, total, 1.5); tau != 1.0 {
+		t.Errorf("expected the maximum threshold for an unreachable density, got %v", tau)
+	}
+}
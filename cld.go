@@ -3,10 +3,10 @@ package colidr
 import (
 	"fmt"
 	"image"
+	"image/color"
 	"math"
 	"os"
 	"strconv"
-	"sync"
 
 	"gocv.io/x/gocv"
 )
@@ -14,10 +14,22 @@ import (
 // Cld is the main entry struct for the Coherent Line Drawing operations.
 type Cld struct {
 	Image  gocv.Mat
+	source gocv.Mat
 	result gocv.Mat
 	dog    gocv.Mat
 	fDog   gocv.Mat
 	etf    *Etf
+	mask   *gocv.Mat
+
+	paper        *gocv.Mat
+	composite    gocv.Mat
+	compositeErr error
+
+	tauMap    *gocv.Mat
+	sigmaMMap *gocv.Mat
+	sigmaCMap *gocv.Mat
+
+	meta Metadata
 	Options
 }
 
@@ -36,6 +48,76 @@ type Options struct {
 	AntiAlias     bool
 	VisEtf        bool
 	VisResult     bool
+
+	// MaskFile is a grayscale image restricting the line extraction to its white areas.
+	MaskFile string
+	// ROI is a rectangular region of interest used in case no mask image is provided.
+	ROI image.Rectangle
+	// MaskFeather is the radius of the smooth transition around the mask edges.
+	MaskFeather int
+	// OuterTau and OuterSigmaM are applied outside of the mask, overriding the TauMap and SigmaMMap values.
+	// If none of them is set the outer region is left blank.
+	OuterTau    float32
+	OuterSigmaM float64
+
+	// TauMap, SigmaMMap and SigmaCMap are per-pixel parameter maps
+	// overriding the global Tau, SigmaM and SigmaC values.
+	TauMap    ParamMap
+	SigmaMMap ParamMap
+	SigmaCMap ParamMap
+
+	// AutoTau selects the Tau value automatically, using one of the AutoTauDensity or AutoTauOtsu modes.
+	AutoTau string
+	// InkDensity is the targeted percentage of ink pixels used by the AutoTauDensity mode.
+	InkDensity float64
+
+	// StrokeWeight thickens (positive values) or thins (negative values) the lines by the provided number of pixels.
+	StrokeWeight int
+	// TaperWidth is the maximum line width obtained by tapering the lines in function of the gradient magnitude.
+	TaperWidth float64
+	// MinLineLength removes the lines shorter than the provided length.
+	MinLineLength int
+
+	// MinComponentArea removes the connected components having a smaller area.
+	MinComponentArea int
+	// MinElongation removes the blob-like connected components, having a smaller major to minor axis ratio.
+	MinElongation float64
+	// BridgeGap closes the gaps up to the provided length between the components along the flow direction.
+	BridgeGap int
+
+	// HysteresisTau enables the hysteresis thresholding: the pixels between Tau and HysteresisTau
+	// are kept only if they are connected to the pixels below Tau along the flow direction.
+	HysteresisTau float32
+
+	// VizSeed, VizNoiseScale and VizLength control the edge tangent flow visualization.
+	// If VizSeed is zero the default seed is used and if it's negative a random one.
+	VizSeed       int64
+	VizNoiseScale int
+	VizLength     int
+
+	// GradientOperator replaces the OpenCV Sobel operator with one of the pure Go gradient operators.
+	GradientOperator GradientOperator
+
+	// Background is the color the transparent source pixels are composited over. If it's nil, white is used.
+	Background color.Color
+
+	// Paper enables the compositing of the lines over a procedurally generated paper texture.
+	// PaperFile replaces the procedural texture with the provided image.
+	Paper     bool
+	PaperFile string
+	// PaperGrain is the strength of the procedural paper grain, in the [0, 1] range.
+	PaperGrain float64
+	// EdgeDarkening lightens the interior of the strokes relative to their edges, in the [0, 1] range.
+	EdgeDarkening float64
+	// Wobble is the maximum displacement in pixels of the lines along the flow normal.
+	Wobble float64
+	// PaperSeed is the seed of the paper texture and of the wobble.
+	// If it's zero the default seed is used and if it's negative a random one.
+	PaperSeed int64
+
+	// SeparableEtf refines the edge tangent flow in a horizontal and a vertical pass,
+	// a faster approximation of the circular kernel.
+	SeparableEtf bool
 }
 
 // position is a basic struct for vector type operations
@@ -43,8 +125,6 @@ type position struct {
 	x, y float64
 }
 
-var wg sync.WaitGroup
-
 // NewCLD is a constructor method having the source image and the Cld options as parameters.
 func NewCLD(imgFile string, opts Options) (*Cld, error) {
 	f, err := os.Stat(imgFile)
@@ -55,19 +135,70 @@ func NewCLD(imgFile string, opts Options) (*Cld, error) {
 		return nil, fmt.Errorf("missing file name")
 	}
 
-	srcImage := gocv.IMRead(imgFile, gocv.IMReadGrayScale)
+	img, err := LoadImage(imgFile, opts.Background)
+	if err != nil {
+		return nil, err
+	}
+	return NewCLDFromImage(img, opts)
+}
+
+// NewCLDFromImage is a constructor method having an already decoded source image and the Cld options as parameters.
+// The transparent pixels are composited over the background color provided in the options.
+func NewCLDFromImage(img image.Image, opts Options) (*Cld, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	if o, ok := img.(interface{ Opaque() bool }); !ok || !o.Opaque() {
+		img = flatten(img, opts.Background)
+	}
+	source := imageToMat(img)
+	srcImage := gocv.NewMat()
+	gocv.CvtColor(source, &srcImage, gocv.ColorBGRToGray)
 	rows, cols := srcImage.Rows(), srcImage.Cols()
+	size := image.Point{X: cols, Y: rows}
 
 	result := gocv.NewMatWithSize(rows, cols, gocv.MatTypeCV8UC1)
 	dog := gocv.NewMatWithSize(rows, cols, gocv.MatTypeCV32F)
 	fDog := gocv.NewMatWithSize(rows, cols, gocv.MatTypeCV32F)
 
+	mask, err := newMask(opts, size)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize the mask: %s", err)
+	}
+
+	c := &Cld{
+		Image:   srcImage,
+		source:  source,
+		result:  result,
+		dog:     dog,
+		fDog:    fDog,
+		mask:    mask,
+		Options: opts,
+	}
+	if c.paper, err = newPaper(opts, size); err != nil {
+		return nil, fmt.Errorf("unable to load the paper texture: %s", err)
+	}
+	if c.tauMap, err = opts.TauMap.load(size); err != nil {
+		return nil, fmt.Errorf("unable to load the Tau map: %s", err)
+	}
+	if c.sigmaMMap, err = opts.SigmaMMap.load(size); err != nil {
+		return nil, fmt.Errorf("unable to load the SigmaM map: %s", err)
+	}
+	if c.sigmaCMap, err = opts.SigmaCMap.load(size); err != nil {
+		return nil, fmt.Errorf("unable to load the SigmaC map: %s", err)
+	}
+
 	etf := NewETF()
 	etf.Init(cols, rows)
+	etf.mask = mask
+	etf.SetGradientOperator(opts.GradientOperator)
+	etf.SetSeparable(opts.SeparableEtf)
+	c.etf = etf
 
 	e := newEvent("Initialize ETF")
 	e.start()
-	err = etf.InitDefaultEtf(imgFile, image.Point{X: cols, Y: rows})
+	err = etf.InitFromMat(source, size)
 	if err != nil {
 		return nil, fmt.Errorf("unable to initialize edge tangent flow: %s", err)
 	}
@@ -84,7 +215,7 @@ func NewCLD(imgFile string, opts Options) (*Cld, error) {
 		e.stop()
 	}
 
-	return &Cld{srcImage, result, dog, fDog, etf, opts}, nil
+	return c, nil
 }
 
 // GenerateCld is the entry method for generating the coherent line drawing output.
@@ -105,6 +236,9 @@ func (c *Cld) GenerateCld() []byte {
 	}
 	e.stop()
 
+	c.cleanup()
+	c.strokes()
+
 	if c.VisResult {
 		window := gocv.NewWindow("result")
 		window.SetWindowTitle("End result")
@@ -116,17 +250,26 @@ func (c *Cld) GenerateCld() []byte {
 	if c.AntiAlias {
 		pp.AntiAlias(c.result, c.result)
 	}
+	if c.paper != nil {
+		c.compositeErr = c.compositePaper()
+	}
 	if c.VisEtf {
 		e := newEvent("Visualize ETF")
 		e.start()
-		preview := gocv.NewMatWithSize(c.Image.Rows(), c.Image.Cols(), gocv.MatTypeCV32F)
-		pp.VizEtf(&c.etf.flowField, &preview)
+		preview := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), c.Image.Rows(), c.Image.Cols(), gocv.MatTypeCV32F)
+		err := pp.VizEtf(&c.etf.flowField, &preview, VizOptions{
+			Seed:       c.VizSeed,
+			NoiseScale: c.VizNoiseScale,
+			Length:     c.VizLength,
+		})
 		e.stop()
 
-		window := gocv.NewWindow("etf")
-		window.SetWindowTitle("ETF flowfield")
-		window.IMShow(preview)
-		window.WaitKey(0)
+		if err == nil {
+			window := gocv.NewWindow("etf")
+			window.SetWindowTitle("ETF flowfield")
+			window.IMShow(preview)
+			window.WaitKey(0)
+		}
 	}
 
 	return c.result.ToBytes()
@@ -139,52 +282,68 @@ func (c *Cld) generate() {
 
 	c.gradientDoG(&srcImg32FC1, &c.dog, c.Rho, c.SigmaC)
 	c.flowDoG(&c.dog, &c.fDog, c.SigmaM)
-	c.binaryThreshold(&c.fDog, &c.result, c.Tau)
+
+	c.meta.Tau = c.Tau
+	if c.AutoTau != "" {
+		c.meta.Tau = c.autoTau(&c.fDog)
+	}
+	if c.HysteresisTau > 0 {
+		c.hysteresisThreshold(&c.fDog, &c.result, c.meta.Tau, c.HysteresisTau)
+	} else {
+		c.binaryThreshold(&c.fDog, &c.result, c.meta.Tau)
+	}
+
+	if c.mask != nil {
+		c.applyMask()
+	}
 }
 
 // gradientDoG computes the gradient difference-of-Gaussians (DoG)
+// If a SigmaC map is provided, the gaussian kernels are computed from the local SigmaC values.
 func (c *Cld) gradientDoG(src, dst *gocv.Mat, rho, sigmaC float64) {
-	var sigmaS = c.SigmaR * sigmaC
-	gvc := makeGaussianVector(sigmaC)
-	gvs := makeGaussianVector(sigmaS)
-	kernel := len(gvs) - 1
-
 	width, height := dst.Cols(), dst.Rows()
 
-	wg.Add(width * height)
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			go func(y, x int) {
-				defer wg.Done()
+	srcData, _ := src.DataPtrFloat32()
+	dstData, _ := dst.DataPtrFloat32()
+	flow, _ := c.etf.flowField.DataPtrFloat32()
+	sigmaCMap := paramData(c.sigmaCMap)
+
+	parallelRows(height, func(start, end int) {
+		gvc := gauCache.get(sigmaC)
+		gvs := gauCache.get(c.SigmaR * sigmaC)
+
+		for y := start; y < end; y++ {
+			for x := 0; x < width; x++ {
 				var (
 					gauCAcc, gauSAcc             float64
 					gauCWeightAcc, gauSWeightAcc float64
 				)
+				idx := y*width + x
 
-				c.etf.mu.Lock()
-				defer c.etf.mu.Unlock()
-
-				tmp := c.etf.flowField.GetVecfAt(y, x)
-				gradient := position{x: float64(-tmp[0]), y: float64(tmp[1])}
+				if sigmaCMap != nil {
+					sigmaC := quantizeSigma(sigmaCMap[idx])
+					gvc = gauCache.get(sigmaC)
+					gvs = gauCache.get(c.SigmaR * sigmaC)
+				}
+				kernel := len(gvs) - 1
+				gradient := position{x: float64(-flow[3*idx]), y: float64(flow[3*idx+1])}
 
 				for step := -kernel; step <= kernel; step++ {
 					row := float64(y) + gradient.y*float64(step)
 					col := float64(x) + gradient.x*float64(step)
 
-					if row > float64(dst.Rows()-1) || row < 0.0 || col > float64(dst.Cols()-1) || col < 0.0 {
+					if row > float64(height-1) || row < 0.0 || col > float64(width-1) || col < 0.0 {
 						continue
 					}
-					val := src.GetFloatAt(int(math.Round(row)), int(math.Round(col)))
+					val := srcData[int(math.Round(row))*width+int(math.Round(col))]
 
 					gauIdx := absInt(step)
-					gauCWeight := func(gauIdx int) float64 {
-						if gauIdx >= len(gvc) {
-							return 0.0
-						}
-						return gvc[gauIdx]
-					}(gauIdx)
-
+					var gauCWeight float64
+					if gauIdx < len(gvc) {
+						gauCWeight = gvc[gauIdx]
+					}
 					gauSWeight := gvs[gauIdx]
+
 					gauCAcc += float64(val) * gauCWeight
 					gauSAcc += float64(val) * gauSWeight
 					gauCWeightAcc += gauCWeight
@@ -194,165 +353,119 @@ func (c *Cld) gradientDoG(src, dst *gocv.Mat, rho, sigmaC float64) {
 				vc := gauCAcc / gauCWeightAcc
 				vs := gauSAcc / gauSWeightAcc
 
-				res := vc - rho*vs
-				dst.SetFloatAt(y, x, float32(res))
-			}(y, x)
+				dstData[idx] = float32(vc - rho*vs)
+			}
 		}
-	}
-	wg.Wait()
+	})
 }
 
 // flowDoG computes the flow difference-of-Gaussians (DoG)
+// If a SigmaM map is provided, the gaussian kernel is computed from the local SigmaM value.
 func (c *Cld) flowDoG(src, dst *gocv.Mat, sigmaM float64) {
-	var (
-		gauAcc       float64
-		gauWeightAcc float64
-	)
+	c.integrateFlow(src, dst, sigmaM)
+	gocv.Normalize(*dst, dst, 0.0, 1.0, gocv.NormMinMax)
+}
 
-	gausVec := makeGaussianVector(sigmaM)
+// integrateFlow integrates the gradient DoG along the edge tangent flow, without normalizing the result.
+func (c *Cld) integrateFlow(src, dst *gocv.Mat, sigmaM float64) {
 	width, height := src.Cols(), src.Rows()
-	kernelHalf := len(gausVec) - 1
-
-	wg.Add(width * height)
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			go func(y, x int) {
-				defer wg.Done()
-				c.etf.mu.Lock()
-				defer c.etf.mu.Unlock()
-
-				gauAcc = -gausVec[0] * float64(src.GetFloatAt(y, x))
-				gauWeightAcc = -gausVec[0]
-
-				// Integral alone ETF
-				pos := &position{x: float64(x), y: float64(y)}
-				for step := 0; step < kernelHalf; step++ {
-					tmp := c.etf.flowField.GetVecfAt(int(pos.y), int(pos.x))
-					direction := &position{x: float64(tmp[1]), y: float64(tmp[0])}
-
-					if direction.x == 0 && direction.y == 0 {
-						break
-					}
-
-					if pos.x > float64(width-1) || pos.x < 0.0 ||
-						pos.y > float64(height-1) || pos.y < 0.0 {
-						break
-					}
-
-					value := src.GetFloatAt(int(pos.y), int(pos.x))
-					weight := gausVec[step]
 
-					gauAcc += float64(value) * weight
-					gauWeightAcc += weight
+	srcData, _ := src.DataPtrFloat32()
+	dstData, _ := dst.DataPtrFloat32()
+	flow, _ := c.etf.flowField.DataPtrFloat32()
+	sigmaMMap := paramData(c.sigmaMMap)
 
-					// move along the ETF direction
-					pos.x += direction.x
-					pos.y += direction.y
+	parallelRows(height, func(start, end int) {
+		gausVec := gauCache.get(sigmaM)
 
-					if int(math.Round(pos.x)) < 0 || int(math.Round(pos.x)) > width-1 ||
-						int(math.Round(pos.y)) < 0 || int(math.Round(pos.y)) > height-1 {
-						break
-					}
+		for y := start; y < end; y++ {
+			for x := 0; x < width; x++ {
+				idx := y*width + x
+				if sigmaMMap != nil {
+					gausVec = gauCache.get(quantizeSigma(sigmaMMap[idx]))
 				}
+				kernelHalf := len(gausVec) - 1
 
-				// Integral alone inverse ETF
-				pos = &position{x: float64(x), y: float64(y)}
-				for step := 0; step < kernelHalf; step++ {
-					tmp := c.etf.flowField.GetVecfAt(int(pos.y), int(pos.x))
-					direction := &position{x: float64(-tmp[1]), y: float64(-tmp[0])}
+				gauAcc := -gausVec[0] * float64(srcData[idx])
+				gauWeightAcc := -gausVec[0]
 
-					if direction.x == 0 && direction.y == 0 {
-						break
-					}
+				// Integral along the ETF, then along the inverse ETF.
+				for _, sign := range []float32{1, -1} {
+					pos := position{x: float64(x), y: float64(y)}
+					for step := 0; step < kernelHalf; step++ {
+						i := int(pos.y)*width + int(pos.x)
+						direction := position{x: float64(sign * flow[3*i+1]), y: float64(sign * flow[3*i])}
 
-					if pos.x > float64(width-1) || pos.x < 0.0 ||
-						pos.y > float64(height-1) || pos.y < 0.0 {
-						break
-					}
+						if direction.x == 0 && direction.y == 0 {
+							break
+						}
 
-					value := src.GetFloatAt(int(pos.y), int(pos.x))
-					weight := gausVec[step]
+						if pos.x > float64(width-1) || pos.x < 0.0 ||
+							pos.y > float64(height-1) || pos.y < 0.0 {
+							break
+						}
 
-					gauAcc += float64(value) * weight
-					gauWeightAcc += weight
+						weight := gausVec[step]
+						gauAcc += float64(srcData[i]) * weight
+						gauWeightAcc += weight
 
-					// move along the ETF direction
-					pos.x += direction.x
-					pos.y += direction.y
+						// move along the ETF direction
+						pos.x += direction.x
+						pos.y += direction.y
 
-					if int(math.Round(pos.x)) < 0 || int(math.Round(pos.x)) > width-1 ||
-						int(math.Round(pos.y)) < 0 || int(math.Round(pos.y)) > height-1 {
-						break
+						if int(math.Round(pos.x)) < 0 || int(math.Round(pos.x)) > width-1 ||
+							int(math.Round(pos.y)) < 0 || int(math.Round(pos.y)) > height-1 {
+							break
+						}
 					}
 				}
 
-				newVal := func(gauAcc, gauWeightAcc float64) float64 {
-					var res float64
-
-					if gauAcc/gauWeightAcc > 0 {
-						res = 1.0
-					} else {
-						res = 1.0 + math.Tanh(gauAcc/gauWeightAcc)
-					}
-					return res
+				var res float64
+				if gauAcc/gauWeightAcc > 0 {
+					res = 1.0
+				} else {
+					res = 1.0 + math.Tanh(gauAcc/gauWeightAcc)
 				}
-
-				// Update pixel value in the destination matrix.
-				dst.SetFloatAt(y, x, float32(newVal(gauAcc, gauWeightAcc)))
-			}(y, x)
+				dstData[idx] = float32(res)
+			}
 		}
-	}
-	gocv.Normalize(*dst, dst, 0.0, 1.0, gocv.NormMinMax)
-	wg.Wait()
+	})
 }
 
 // binaryThreshold applies a black and white threshold dithering.
+// If a Tau map is provided, each pixel is thresholded against its local Tau value.
 func (c *Cld) binaryThreshold(src, dst *gocv.Mat, tau float32) []byte {
 	width, height := dst.Cols(), dst.Rows()
-	wg.Add(width * height)
-
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			go func(y, x int) {
-				defer wg.Done()
-				c.etf.mu.Lock()
-				defer c.etf.mu.Unlock()
-
-				h := src.GetFloatAt(y, x)
-				v := func(h float32) uint8 {
-					if h < tau {
-						return 0
-					}
-					return 255
-				}(h)
-				dst.SetUCharAt(y, x, v)
-			}(y, x)
+
+	srcData, _ := src.DataPtrFloat32()
+	dstData := dst.DataPtrUint8()
+	tauMap := paramData(c.tauMap)
+
+	parallelRows(height, func(start, end int) {
+		for i := start * width; i < end*width; i++ {
+			t := tau
+			if tauMap != nil {
+				t = tauMap[i]
+			}
+			if srcData[i] < t {
+				dstData[i] = 0
+			} else {
+				dstData[i] = 255
+			}
 		}
-	}
-	wg.Wait()
+	})
 	return dst.ToBytes()
 }
 
 // combineImage combines multiple images and applies a gaussian blur for smooth edges
 func (c *Cld) combineImage() {
-	width, height := c.Image.Cols(), c.Image.Rows()
-	wg.Add(width * height)
-	for y := 0; y < c.Image.Rows(); y++ {
-		for x := 0; x < c.Image.Cols(); x++ {
-			go func(y, x int) {
-				defer wg.Done()
-				c.etf.mu.Lock()
-				defer c.etf.mu.Unlock()
-
-				h := c.result.GetUCharAt(y, x)
-				if h == 0 {
-					c.Image.SetUCharAt(y, x, 0)
-				}
-			}(y, x)
+	img := c.Image.DataPtrUint8()
+	for i, h := range c.result.DataPtrUint8() {
+		if h == 0 {
+			img[i] = 0
 		}
 	}
 
 	// Apply a gaussian blur for more smoothness
 	gocv.GaussianBlur(c.Image, &c.Image, image.Point{c.BlurSize, c.BlurSize}, 0.0, 0.0, gocv.BorderConstant)
-	wg.Wait()
 }
@@ -0,0 +1,512 @@
+package colidr
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// imageSize is the size of the fixture images.
+var imageSize = image.Point{X: 64, Y: 64}
+
+const (
+	// pixelTolerance is the maximum intensity difference of two pixels considered identical.
+	pixelTolerance = 32
+	// diffTolerance is the maximum ratio of the different pixels accepted by the golden tests.
+	diffTolerance = 0.01
+)
+
+// fixture returns the path of a fixture image.
+func fixture(name string) string {
+	return filepath.Join("testdata", name+".png")
+}
+
+// golden returns the path of a golden image.
+func golden(name string) string {
+	return filepath.Join("testdata", "golden", name+".png")
+}
+
+// loadFixture decodes a PNG image from the testdata folder.
+func loadFixture(tb testing.TB, name string) image.Image {
+	f, err := os.Open(fixture(name))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return img
+}
+
+// testOptions returns the default options of the CLI application.
+func testOptions() Options {
+	return Options{
+		SigmaR:       2.6,
+		SigmaM:       3.0,
+		SigmaC:       1.0,
+		Rho:          0.98,
+		Tau:          0.98,
+		BlurSize:     3,
+		EtfKernel:    3,
+		EtfIteration: 1,
+	}
+}
+
+// diffImages returns the ratio of the pixels which differ more than the pixel tolerance.
+func diffImages(a, b *image.Gray) float64 {
+	if a.Bounds() != b.Bounds() {
+		return 1.0
+	}
+	var diff int
+	for y := a.Bounds().Min.Y; y < a.Bounds().Max.Y; y++ {
+		for x := a.Bounds().Min.X; x < a.Bounds().Max.X; x++ {
+			d := int(a.GrayAt(x, y).Y) - int(b.GrayAt(x, y).Y)
+			if absInt(d) > pixelTolerance {
+				diff++
+			}
+		}
+	}
+	return float64(diff) / float64(a.Bounds().Dx()*a.Bounds().Dy())
+}
+
+// newTestCld returns a Cld with a uniform vertical flow field, without reading any image.
+func newTestCld(size int, opts Options) *Cld {
+	return &Cld{
+		Image:   gocv.NewMatWithSize(size, size, gocv.MatTypeCV8UC1),
+		source:  gocv.NewMatWithSize(size, size, gocv.MatTypeCV8UC3),
+		result:  gocv.NewMatWithSize(size, size, gocv.MatTypeCV8UC1),
+		dog:     gocv.NewMatWithSize(size, size, gocv.MatTypeCV32F),
+		fDog:    gocv.NewMatWithSize(size, size, gocv.MatTypeCV32F),
+		etf:     newUniformEtf(size, gocv.Vecf{1, 0, 0}, 0.5),
+		Options: opts,
+	}
+}
+
+func TestCld_GradientDoG(t *testing.T) {
+	opts := testOptions()
+	c := newTestCld(16, opts)
+
+	src := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0.5, 0, 0, 0), 16, 16, gocv.MatTypeCV32F)
+	c.gradientDoG(&src, &c.dog, opts.Rho, opts.SigmaC)
+
+	// On a uniform image both gaussians return the same value, so the DoG is (1-rho)*value.
+	expected := 0.5 - opts.Rho*0.5
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if v := c.dog.GetFloatAt(y, x); math.Abs(float64(v)-expected) > 1e-5 {
+				t.Fatalf("expected DoG value %v at (%d, %d), got %v", expected, x, y, v)
+			}
+		}
+	}
+}
+
+func TestCld_FlowDoG(t *testing.T) {
+	opts := testOptions()
+	c := newTestCld(16, opts)
+
+	// A vertical step edge: negative DoG responses on the left half.
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			v := float32(0.1)
+			if x < 8 {
+				v = -0.5
+			}
+			c.dog.SetFloatAt(y, x, v)
+		}
+	}
+	c.flowDoG(&c.dog, &c.fDog, opts.SigmaM)
+
+	for y := 0; y < 16; y++ {
+		if l, r := c.fDog.GetFloatAt(y, 2), c.fDog.GetFloatAt(y, 13); l >= r {
+			t.Fatalf("expected the negative DoG region to be darker at row %d: %v >= %v", y, l, r)
+		}
+		for x := 0; x < 16; x++ {
+			if v := c.fDog.GetFloatAt(y, x); v < 0 || v > 1 {
+				t.Fatalf("expected normalized FDoG values, got %v at (%d, %d)", v, x, y)
+			}
+		}
+	}
+}
+
+func TestCld_BinaryThreshold(t *testing.T) {
+	opts := testOptions()
+	c := newTestCld(4, opts)
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			c.fDog.SetFloatAt(y, x, float32(x)/3.0)
+		}
+	}
+	c.binaryThreshold(&c.fDog, &c.result, 0.5)
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			expected := uint8(255)
+			if float32(x)/3.0 < 0.5 {
+				expected = 0
+			}
+			if v := c.result.GetUCharAt(y, x); v != expected {
+				t.Errorf("expected %d at (%d, %d), got %d", expected, x, y, v)
+			}
+		}
+	}
+}
+
+func TestCld_SliceAccess(t *testing.T) {
+	opts := testOptions()
+	c, err := NewCLD(fixture("circle"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := gocv.NewMat()
+	c.Image.ConvertTo(&src, gocv.MatTypeCV32F, 1.0/255.0)
+
+	compare := func(stage string, expected, got *gocv.Mat) {
+		for y := 0; y < expected.Rows(); y++ {
+			for x := 0; x < expected.Cols(); x++ {
+				e, g := expected.GetFloatAt(y, x), got.GetFloatAt(y, x)
+				if math.Abs(float64(e-g)) > 1e-6 {
+					t.Fatalf("%s: expected %v at (%d, %d), got %v", stage, e, x, y, g)
+				}
+			}
+		}
+	}
+
+	dog := c.dog.Clone()
+	gradientDoGReference(c, &src, &dog, opts.Rho, opts.SigmaC)
+	c.gradientDoG(&src, &c.dog, opts.Rho, opts.SigmaC)
+	compare("gradient DoG", &dog, &c.dog)
+
+	fDog := c.fDog.Clone()
+	integrateFlowReference(c, &c.dog, &fDog, opts.SigmaM)
+	c.integrateFlow(&c.dog, &c.fDog, opts.SigmaM)
+	compare("flow DoG", &fDog, &c.fDog)
+
+	gocv.Normalize(c.fDog, &c.fDog, 0.0, 1.0, gocv.NormMinMax)
+	result := c.result.Clone()
+	binaryThresholdReference(c, &c.fDog, &result, opts.Tau)
+	c.binaryThreshold(&c.fDog, &c.result, opts.Tau)
+	for i, v := range result.ToBytes() {
+		if g := c.result.ToBytes()[i]; g != v {
+			t.Fatalf("binary threshold: expected %d at index %d, got %d", v, i, g)
+		}
+	}
+}
+
+// TestCld_FlowDoGNormalization checks that the FDoG is normalized only after the whole flow integration is done.
+func TestCld_FlowDoGNormalization(t *testing.T) {
+	opts := testOptions()
+	c, err := NewCLD(fixture("circle"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := gocv.NewMat()
+	c.Image.ConvertTo(&src, gocv.MatTypeCV32F, 1.0/255.0)
+	c.gradientDoG(&src, &c.dog, opts.Rho, opts.SigmaC)
+
+	raw := c.fDog.Clone()
+	c.integrateFlow(&c.dog, &raw, opts.SigmaM)
+	lo, hi, _, _ := gocv.MinMaxLoc(raw)
+
+	c.flowDoG(&c.dog, &c.fDog, opts.SigmaM)
+	for y := 0; y < c.fDog.Rows(); y++ {
+		for x := 0; x < c.fDog.Cols(); x++ {
+			expected := (raw.GetFloatAt(y, x) - lo) / (hi - lo)
+			if v := c.fDog.GetFloatAt(y, x); math.Abs(float64(v-expected)) > 1e-5 {
+				t.Fatalf("expected the normalized FDoG value %v at (%d, %d), got %v", expected, x, y, v)
+			}
+		}
+	}
+}
+
+// TestCld_CombineImage checks that the source image is blurred only after all the line pixels are combined.
+func TestCld_CombineImage(t *testing.T) {
+	opts := testOptions()
+	c := newTestCld(32, opts)
+	c.Image.SetTo(gocv.NewScalar(200, 0, 0, 0))
+	c.result.SetTo(gocv.NewScalar(255, 0, 0, 0))
+	for y := 4; y < 28; y++ {
+		c.result.SetUCharAt(y, 16, 0)
+	}
+
+	expected := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(200, 0, 0, 0), 32, 32, gocv.MatTypeCV8UC1)
+	for y := 4; y < 28; y++ {
+		expected.SetUCharAt(y, 16, 0)
+	}
+	gocv.GaussianBlur(expected, &expected, image.Point{opts.BlurSize, opts.BlurSize}, 0.0, 0.0, gocv.BorderConstant)
+
+	c.combineImage()
+	if !bytes.Equal(c.Image.ToBytes(), expected.ToBytes()) {
+		t.Error("expected the combined image to be blurred after the lines are drawn on it")
+	}
+}
+
+func TestCld_Golden(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		opts    func(*Options)
+	}{
+		{"circle_default", "circle", func(*Options) {}},
+		{"circle_fdog_iteration", "circle", func(o *Options) { o.FDogIteration = 1 }},
+		{"stripes_default", "stripes", func(*Options) {}},
+		{"stripes_kernel", "stripes", func(o *Options) { o.EtfKernel = 5; o.EtfIteration = 2 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			tt.opts(&opts)
+
+			c, err := NewCLD(fixture(tt.fixture), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := c.GenerateCld()
+			got := &image.Gray{
+				Pix:    data,
+				Stride: c.Image.Cols(),
+				Rect:   image.Rect(0, 0, c.Image.Cols(), c.Image.Rows()),
+			}
+
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(golden(tt.name)), 0755); err != nil {
+					t.Fatal(err)
+				}
+				f, err := os.Create(golden(tt.name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				if err := png.Encode(f, got); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			f, err := os.Open(golden(tt.name))
+			if os.IsNotExist(err) {
+				t.Fatalf("missing golden file %s, generate it with the -update flag", golden(tt.name))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			img, err := png.Decode(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, ok := img.(*image.Gray)
+			if !ok {
+				t.Fatalf("expected a grayscale golden image")
+			}
+			if diff := diffImages(got, expected); diff > diffTolerance {
+				t.Errorf("the output differs from the golden image in %.2f%% of the pixels", diff*100)
+			}
+		})
+	}
+}
+
+func BenchmarkCld_GradientDoG(b *testing.B) {
+	opts := testOptions()
+	c := newTestCld(64, opts)
+	src := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0.5, 0, 0, 0), 64, 64, gocv.MatTypeCV32F)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		c.gradientDoG(&src, &c.dog, opts.Rho, opts.SigmaC)
+	}
+}
+
+func BenchmarkCld_FlowDoG(b *testing.B) {
+	opts := testOptions()
+	c := newTestCld(64, opts)
+	c.dog.SetTo(gocv.NewScalar(-0.1, 0, 0, 0))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		c.flowDoG(&c.dog, &c.fDog, opts.SigmaM)
+	}
+}
+
+func BenchmarkCld_BinaryThreshold(b *testing.B) {
+	opts := testOptions()
+	c := newTestCld(64, opts)
+	c.fDog.SetTo(gocv.NewScalar(0.5, 0, 0, 0))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		c.binaryThreshold(&c.fDog, &c.result, opts.Tau)
+	}
+}
+
+func BenchmarkCld_GenerateCld(b *testing.B) {
+	opts := testOptions()
+	for i := 0; i < b.N; i++ {
+		c, err := NewCLD(fixture("circle"), opts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		c.GenerateCld()
+	}
+}
+
+// gradientDoGReference computes the gradient DoG pixel by pixel with the Mat accessors, the reference implementation.
+func gradientDoGReference(c *Cld, src, dst *gocv.Mat, rho, sigmaC float64) {
+	gvc := gauCache.get(sigmaC)
+	gvs := gauCache.get(c.SigmaR * sigmaC)
+	kernel := len(gvs) - 1
+
+	for y := 0; y < dst.Rows(); y++ {
+		for x := 0; x < dst.Cols(); x++ {
+			var gauCAcc, gauSAcc, gauCWeightAcc, gauSWeightAcc float64
+
+			tmp := c.etf.flowField.GetVecfAt(y, x)
+			gradient := position{x: float64(-tmp[0]), y: float64(tmp[1])}
+
+			for step := -kernel; step <= kernel; step++ {
+				row := float64(y) + gradient.y*float64(step)
+				col := float64(x) + gradient.x*float64(step)
+
+				if row > float64(dst.Rows()-1) || row < 0.0 || col > float64(dst.Cols()-1) || col < 0.0 {
+					continue
+				}
+				val := float64(src.GetFloatAt(int(math.Round(row)), int(math.Round(col))))
+
+				gauIdx := absInt(step)
+				var gauCWeight float64
+				if gauIdx < len(gvc) {
+					gauCWeight = gvc[gauIdx]
+				}
+				gauCAcc += val * gauCWeight
+				gauSAcc += val * gvs[gauIdx]
+				gauCWeightAcc += gauCWeight
+				gauSWeightAcc += gvs[gauIdx]
+			}
+			dst.SetFloatAt(y, x, float32(gauCAcc/gauCWeightAcc-rho*gauSAcc/gauSWeightAcc))
+		}
+	}
+}
+
+// integrateFlowReference integrates the gradient DoG along the flow pixel by pixel with the Mat accessors,
+// the reference implementation.
+func integrateFlowReference(c *Cld, src, dst *gocv.Mat, sigmaM float64) {
+	width, height := src.Cols(), src.Rows()
+	gausVec := gauCache.get(sigmaM)
+	kernelHalf := len(gausVec) - 1
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			gauAcc := -gausVec[0] * float64(src.GetFloatAt(y, x))
+			gauWeightAcc := -gausVec[0]
+
+			for _, sign := range []float32{1, -1} {
+				pos := position{x: float64(x), y: float64(y)}
+				for step := 0; step < kernelHalf; step++ {
+					tmp := c.etf.flowField.GetVecfAt(int(pos.y), int(pos.x))
+					direction := position{x: float64(sign * tmp[1]), y: float64(sign * tmp[0])}
+
+					if direction.x == 0 && direction.y == 0 {
+						break
+					}
+					if pos.x > float64(width-1) || pos.x < 0.0 || pos.y > float64(height-1) || pos.y < 0.0 {
+						break
+					}
+					gauAcc += float64(src.GetFloatAt(int(pos.y), int(pos.x))) * gausVec[step]
+					gauWeightAcc += gausVec[step]
+
+					pos.x += direction.x
+					pos.y += direction.y
+
+					if int(math.Round(pos.x)) < 0 || int(math.Round(pos.x)) > width-1 ||
+						int(math.Round(pos.y)) < 0 || int(math.Round(pos.y)) > height-1 {
+						break
+					}
+				}
+			}
+
+			res := 1.0
+			if gauAcc/gauWeightAcc <= 0 {
+				res = 1.0 + math.Tanh(gauAcc/gauWeightAcc)
+			}
+			dst.SetFloatAt(y, x, float32(res))
+		}
+	}
+}
+
+// binaryThresholdReference thresholds the FDoG pixel by pixel with the Mat accessors, the reference implementation.
+func binaryThresholdReference(c *Cld, src, dst *gocv.Mat, tau float32) {
+	for y := 0; y < dst.Rows(); y++ {
+		for x := 0; x < dst.Cols(); x++ {
+			var v uint8 = 255
+			if src.GetFloatAt(y, x) < tau {
+				v = 0
+			}
+			dst.SetUCharAt(y, x, v)
+		}
+	}
+}
+
+func BenchmarkCld_GradientDoGReference(b *testing.B) {
+	opts := testOptions()
+	c := newTestCld(64, opts)
+	src := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0.5, 0, 0, 0), 64, 64, gocv.MatTypeCV32F)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		gradientDoGReference(c, &src, &c.dog, opts.Rho, opts.SigmaC)
+	}
+}
+
+func BenchmarkCld_FlowDoGReference(b *testing.B) {
+	opts := testOptions()
+	c := newTestCld(64, opts)
+	c.dog.SetTo(gocv.NewScalar(-0.1, 0, 0, 0))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		integrateFlowReference(c, &c.dog, &c.fDog, opts.SigmaM)
+		gocv.Normalize(c.fDog, &c.fDog, 0.0, 1.0, gocv.NormMinMax)
+	}
+}
+
+func BenchmarkCld_BinaryThresholdReference(b *testing.B) {
+	opts := testOptions()
+	c := newTestCld(64, opts)
+	c.fDog.SetTo(gocv.NewScalar(0.5, 0, 0, 0))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		binaryThresholdReference(c, &c.fDog, &c.result, opts.Tau)
+	}
+}
+
+func TestCld_VisualizeFlowReproducible(t *testing.T) {
+	c, err := NewCLD(fixture("circle"), testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := func() []uint8 {
+		fv, err := c.VisualizeFlow(VizLIC, VizOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fv.Image().Pix
+	}
+	if !bytes.Equal(render(), render()) {
+		t.Error("expected the default flow visualization to be reproducible")
+	}
+}
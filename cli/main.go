@@ -3,17 +3,19 @@ package main
 import (
 	"flag"
 	"fmt"
+	"image"
+	"image/color"
 	"image/jpeg"
 	"image/png"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/esimov/colidr"
-	"gocv.io/x/gocv"
 	"golang.org/x/image/bmp"
 )
 
@@ -39,14 +41,73 @@ func main() {
 		sigmaC        = flag.Float64("sc", 1.0, "SigmaC")
 		rho           = flag.Float64("rho", 0.98, "Rho")
 		tau           = flag.Float64("tau", 0.98, "Tau")
+		hysteresisTau = flag.Float64("htau", 0, "Weak Tau used by the hysteresis thresholding along the flow")
 		etfKernel     = flag.Int("k", 3, "Etf kernel")
+		gradient      = flag.String("grad", "", "Pure Go gradient operator used by the Etf: sobel, scharr or prewitt")
 		etfIteration  = flag.Int("ei", 1, "Number of Etf iteration")
+		separableEtf  = flag.Bool("es", false, "Separable Etf refinement, a faster approximation")
 		fDogIteration = flag.Int("di", 0, "Number of FDoG iteration")
 		blurSize      = flag.Int("bl", 3, "Blur size")
 		antiAlias     = flag.Bool("aa", false, "Anti aliasing")
 		visEtf        = flag.Bool("ve", false, "Visualize Etf")
 		visResult     = flag.Bool("vr", false, "Visualize end result")
+		vizSeed       = flag.Int64("vseed", 0, "Etf visualization noise seed (random if negative)")
+		vizNoiseScale = flag.Int("vscale", 2, "Etf visualization noise scale")
+		vizLength     = flag.Int("vlen", 10, "Etf visualization streamline length")
+		vizMode       = flag.String("vm", colidr.VizLIC, "Etf visualization mode: lic, hsv, arrows or streamlines")
+		vizSpacing    = flag.Int("vsp", 16, "Etf visualization arrow and streamline spacing")
+		vizOutput     = flag.String("vo", "", "Etf visualization output file (.png or .svg)")
+		hatch         = flag.Bool("hatch", false, "Fill the dark regions with flow guided hatching")
+		hatchSpacing  = flag.Int("hs", 6, "Hatching stroke spacing")
+		hatchTone     = flag.Float64("ht", 0.6, "Tone below which the regions are hatched")
+		crossTone     = flag.Float64("hct", 0.3, "Tone below which the regions are cross-hatched")
+		stipple       = flag.Bool("stipple", false, "Render the image as weighted Voronoi stippling")
+		stippleDots   = flag.Int("sd", 5000, "Number of stipple dots")
+		stippleMinR   = flag.Float64("srmin", 0.5, "Minimum stipple dot radius")
+		stippleMaxR   = flag.Float64("srmax", 2.0, "Maximum stipple dot radius")
+		stippleLine   = flag.Float64("slw", 1.0, "Stipple density added along the lines")
+		kuwahara      = flag.Bool("kuwahara", false, "Render the image as an oil painting with the anisotropic Kuwahara filter")
+		kuwaharaR     = flag.Int("kr", 6, "Anisotropic Kuwahara filter radius")
+		kuwaharaQ     = flag.Float64("kq", 8, "Anisotropic Kuwahara filter sharpness")
+		kuwaharaLines = flag.Bool("kl", false, "Draw the lines over the anisotropic Kuwahara filtered image")
 		potrace       = flag.Bool("pt", true, "Use potrace to smooth edges")
+		matte         = flag.String("matte", "#ffffff", "Background colour the transparent source pixels are composited over")
+		strokeColor   = flag.String("stroke", "#000000", "Line colour")
+		colorMode     = flag.String("cm", colidr.InkSolid, "Line colouring mode: solid (using the stroke colour), source or pencil")
+		darken        = flag.Float64("darken", 0.3, "Darkening factor of the pencil colouring mode")
+		transparent   = flag.Bool("transparent", false, "Transparent background, the alpha being derived from the line intensity")
+		background    = flag.String("bgcolor", "#ffffff", "Page colour of the SVG, PDF and EPS output (none for transparent)")
+		pageSize      = flag.String("page", "", "Page size of the SVG, PDF and EPS output: a3, a4, a5, letter or legal (fits the drawing if empty)")
+		dpi           = flag.Float64("dpi", 72, "Resolution of the SVG, PDF and EPS output")
+		tolerance     = flag.Float64("tol", 0.5, "Path simplification tolerance of the SVG, PDF and EPS output")
+		jpegQuality   = flag.Int("jq", 100, "JPEG quality")
+		pngLevel      = flag.String("pngc", "default", "PNG compression level: default, none, speed or best")
+		tiffLevel     = flag.String("tiffc", colidr.TIFFLZW, "TIFF compression: lzw or none")
+		rawOutput     = flag.String("raw", "", "Raw FDoG field output file (.tif, .tiff or .pfm)")
+		maskFile      = flag.String("mask", "", "Mask image restricting the line extraction to its white areas")
+		roi           = flag.String("roi", "", "Region of interest as x0,y0,x1,y1 (used in case no mask is provided)")
+		maskFeather   = flag.Int("mf", 0, "Mask feather radius")
+		outerTau      = flag.Float64("otau", 0, "Tau applied outside of the mask")
+		outerSigmaM   = flag.Float64("osm", 0, "SigmaM applied outside of the mask")
+		tauMap        = flag.String("tmap", "", "Tau map as min:max:image")
+		sigmaMMap     = flag.String("smmap", "", "SigmaM map as min:max:image")
+		sigmaCMap     = flag.String("scmap", "", "SigmaC map as min:max:image")
+		autoTau       = flag.String("autotau", "", "Automatic Tau selection: density or otsu")
+		inkDensity    = flag.Float64("ink", 10, "Targeted ink pixel percentage used by the density based automatic Tau")
+		strokeWeight  = flag.Int("sw", 0, "Stroke weight: thickens (positive) or thins (negative) the lines")
+		taperWidth    = flag.Float64("tw", 0, "Maximum line width of the gradient magnitude based tapering")
+		minLineLength = flag.Int("ml", 0, "Minimum line length")
+		minArea       = flag.Int("ca", 0, "Minimum connected component area")
+		minElongation = flag.Float64("ce", 0, "Minimum connected component elongation")
+		bridgeGap     = flag.Int("bg", 0, "Maximum gap length bridged along the flow direction")
+		paper         = flag.Bool("paper", false, "Composite the lines over a procedural paper texture")
+		paperFile     = flag.String("ptex", "", "Paper texture image replacing the procedural paper")
+		paperGrain    = flag.Float64("grain", 0.15, "Strength of the procedural paper grain")
+		edgeDarkening = flag.Float64("edark", 0, "Watercolour edge darkening of the strokes composited over the paper")
+		wobble        = flag.Float64("wobble", 0, "Maximum displacement of the lines composited over the paper along the flow normal")
+		paperSeed     = flag.Int64("pseed", 0, "Paper texture and wobble seed (random if negative)")
+		memoryBudget  = flag.Int("mem", 0, "Memory budget in MB of the tiled processing of large images (disabled if 0), including the decoding of the source image")
+		tileSize      = flag.Int("tile", 0, "Tile size of the tiled processing, overriding the one derived from the memory budget")
 	)
 
 	flag.Usage = func() {
@@ -59,19 +120,94 @@ func main() {
 		log.Fatal("Usage: colidr -in <source> -out <destination>")
 	}
 
-	fileTypes := []string{".jpg", ".jpeg", ".png", ".bmp"}
+	fileTypes := []string{".jpg", ".jpeg", ".png", ".bmp", ".tif", ".tiff", ".webp", ".pbm", ".pgm"}
+	vectorTypes := []string{".svg", ".pdf", ".eps"}
 	ext := filepath.Ext(*destination)
+	isVector := supportedFiles(ext, vectorTypes)
 
-	if !supportedFiles(ext, fileTypes) {
+	if !supportedFiles(ext, fileTypes) && !isVector {
 		log.Fatalf("Output file type not supported: %v", ext)
 	}
 
+	if *jpegQuality < 1 || *jpegQuality > 100 {
+		log.Fatalf("JPEG quality should be between 1 and 100")
+	}
+	pngLevels := map[string]png.CompressionLevel{
+		"default": png.DefaultCompression,
+		"none":    png.NoCompression,
+		"speed":   png.BestSpeed,
+		"best":    png.BestCompression,
+	}
+	pngCompression, ok := pngLevels[*pngLevel]
+	if !ok {
+		log.Fatalf("PNG compression level not supported: %v", *pngLevel)
+	}
+	if len(*rawOutput) > 0 && !supportedFiles(filepath.Ext(*rawOutput), []string{".tif", ".tiff", ".pfm"}) {
+		log.Fatalf("Raw output file type not supported: %v", filepath.Ext(*rawOutput))
+	}
+
+	lineColor, err := parseColor(*strokeColor)
+	if err != nil {
+		log.Fatalf("invalid stroke colour %q: %v", *strokeColor, err)
+	}
+	inked := *transparent || *colorMode != colidr.InkSolid || (lineColor != nil && lineColor != color.NRGBA{A: 255})
+
+	// potrace traces the black and white line drawing into a PGM file, so it's skipped for the coloured lines,
+	// for the painted image and for the output formats which would be lost by the conversion.
+	tracing := *potrace && !isVector && !inked && !*kuwahara && !supportedFiles(ext, []string{".tif", ".tiff", ".webp", ".pbm", ".pgm"})
+
+	isTiled := *memoryBudget > 0 || *tileSize > 0
+	if isTiled && (isVector || *hatch || *stipple || *kuwahara || inked || len(*vizOutput) > 0 || len(*rawOutput) > 0) {
+		log.Fatalf("the tiled processing supports only the raster line drawing output")
+	}
+
+	if (*hatch || *stipple) && isVector && ext != ".svg" {
+		log.Fatalf("the hatching and the stippling support only the SVG vector output")
+	}
+	if *kuwahara && isVector {
+		log.Fatalf("the anisotropic Kuwahara filter supports only the raster output")
+	}
+
+	var vectorOpts colidr.VectorOptions
+	if isVector {
+		vectorOpts.Stroke = lineColor
+		if vectorOpts.Background, err = parseColor(*background); err != nil {
+			log.Fatalf("invalid background colour %q: %v", *background, err)
+		}
+		vectorOpts.PageSize = *pageSize
+		vectorOpts.DPI = *dpi
+	}
+
+	var rect image.Rectangle
+	if len(*roi) > 0 {
+		if _, err := fmt.Sscanf(*roi, "%d,%d,%d,%d", &rect.Min.X, &rect.Min.Y, &rect.Max.X, &rect.Max.Y); err != nil {
+			log.Fatalf("invalid region of interest %q: %v", *roi, err)
+		}
+		rect = rect.Canon()
+	}
+
+	matteColor, err := parseColor(*matte)
+	if err != nil {
+		log.Fatalf("invalid matte colour %q: %v", *matte, err)
+	}
+
+	paramMaps := make([]colidr.ParamMap, 3)
+	for i, pm := range []string{*tauMap, *sigmaMMap, *sigmaCMap} {
+		if len(pm) > 0 {
+			var err error
+			if paramMaps[i], err = parseParamMap(pm); err != nil {
+				log.Fatalf("invalid parameter map %q: %v", pm, err)
+			}
+		}
+	}
+
 	opts := colidr.Options{
 		SigmaR:        *sigmaR,
 		SigmaM:        *sigmaM,
 		SigmaC:        *sigmaC,
 		Rho:           *rho,
 		Tau:           float32(*tau),
+		HysteresisTau: float32(*hysteresisTau),
 		EtfKernel:     *etfKernel,
 		EtfIteration:  *etfIteration,
 		FDogIteration: *fDogIteration,
@@ -79,30 +215,168 @@ func main() {
 		AntiAlias:     *antiAlias,
 		VisEtf:        *visEtf,
 		VisResult:     *visResult,
+		VizSeed:       *vizSeed,
+		VizNoiseScale: *vizNoiseScale,
+		VizLength:     *vizLength,
+		MaskFile:      *maskFile,
+		ROI:           rect,
+		MaskFeather:   *maskFeather,
+		OuterTau:      float32(*outerTau),
+		OuterSigmaM:   *outerSigmaM,
+		TauMap:        paramMaps[0],
+		SigmaMMap:     paramMaps[1],
+		SigmaCMap:     paramMaps[2],
+		AutoTau:       *autoTau,
+		InkDensity:    *inkDensity,
+		StrokeWeight:  *strokeWeight,
+		TaperWidth:    *taperWidth,
+		MinLineLength: *minLineLength,
+
+		MinComponentArea: *minArea,
+		MinElongation:    *minElongation,
+		BridgeGap:        *bridgeGap,
+		GradientOperator: colidr.GradientOperator(*gradient),
+		Background:       matteColor,
+
+		Paper:         *paper,
+		PaperFile:     *paperFile,
+		PaperGrain:    *paperGrain,
+		EdgeDarkening: *edgeDarkening,
+		Wobble:        *wobble,
+		PaperSeed:     *paperSeed,
+		SeparableEtf:  *separableEtf,
+	}
+
+	if err := opts.Validate(); err != nil {
+		if verr, ok := err.(colidr.ValidationError); ok {
+			fmt.Fprintln(os.Stderr, "Invalid options:")
+			for _, e := range verr {
+				fmt.Fprintf(os.Stderr, "\t%v\n", e)
+			}
+			os.Exit(1)
+		}
+		log.Fatal(err)
 	}
 
 	fmt.Println("Processing:")
 
 	start := time.Now()
-	cld, err := colidr.NewCLD(*source, opts)
-	if err != nil {
-		log.Fatalf("cannot initialize CLD: %v", err)
-	}
+	var (
+		cld       *colidr.Cld
+		tiled     *colidr.TiledResult
+		hatching  *colidr.Hatching
+		stippling *colidr.Stippling
+		img       image.Image
+	)
+	if isTiled {
+		tiled, err = colidr.GenerateTiled(*source, opts, colidr.TileOptions{
+			MemoryBudget: int64(*memoryBudget) << 20,
+			TileSize:     *tileSize,
+		})
+		if err != nil {
+			log.Fatalf("error processing the image tiles: %v", err)
+		}
+		defer tiled.Close()
+
+		if ext != ".pgm" {
+			if img, err = tiled.Image(); err != nil {
+				log.Fatalf("error loading the tiled result: %v", err)
+			}
+		}
+	} else {
+		cld, err = colidr.NewCLD(*source, opts)
+		if err != nil {
+			log.Fatalf("cannot initialize CLD: %v", err)
+		}
 
-	data := cld.GenerateCld()
+		data := cld.GenerateCld()
 
-	rows, cols := cld.Image.Rows(), cld.Image.Cols()
-	mat, err := gocv.NewMatFromBytes(rows, cols, gocv.MatTypeCV8UC1, data)
-	if err != nil {
-		log.Fatalf("error retrieving the byte array: %v", err)
-	}
+		if len(*vizOutput) > 0 {
+			fv, err := cld.VisualizeFlow(*vizMode, colidr.VizOptions{
+				Seed:       *vizSeed,
+				NoiseScale: *vizNoiseScale,
+				Length:     *vizLength,
+				Spacing:    *vizSpacing,
+			})
+			if err != nil {
+				log.Fatalf("error visualizing the edge tangent flow: %v", err)
+			}
+			if err := writeFlowViz(fv, *vizOutput); err != nil {
+				log.Fatalf("error saving the edge tangent flow visualization: %v", err)
+			}
+		}
+		if len(*rawOutput) > 0 {
+			if err := writeRaw(cld, *rawOutput, *tiffLevel); err != nil {
+				log.Fatalf("error saving the raw FDoG field: %v", err)
+			}
+		}
+		if *autoTau != "" {
+			fmt.Printf("\nSelected Tau: %.4f\n", cld.Metadata().Tau)
+		}
+		if *minArea > 0 || *minElongation > 0 {
+			fmt.Printf("\nRemoved components: %d\n", cld.Metadata().RemovedComponents)
+		}
 
-	img, err := mat.ToImage()
-	if err != nil {
-		log.Fatalf("error converting matrix to image: %v", err)
+		rows, cols := cld.Image.Rows(), cld.Image.Cols()
+		img = &image.Gray{Pix: data, Stride: cols, Rect: image.Rect(0, 0, cols, rows)}
+
+		if inked {
+			img, err = cld.Ink(colidr.InkOptions{
+				Mode:        *colorMode,
+				Color:       lineColor,
+				Transparent: *transparent,
+				Darken:      *darken,
+			})
+			if err != nil {
+				log.Fatalf("error coloring the lines: %v", err)
+			}
+		}
+
+		if *paper || *paperFile != "" {
+			if img, err = cld.Composite(); err != nil {
+				log.Fatalf("error compositing the paper texture: %v", err)
+			}
+		}
+
+		if *hatch {
+			hatching, err = cld.Hatch(colidr.HatchOptions{
+				Spacing:        *hatchSpacing,
+				Threshold:      *hatchTone,
+				CrossThreshold: *crossTone,
+				Outlines:       true,
+			})
+			if err != nil {
+				log.Fatalf("error generating the hatching: %v", err)
+			}
+			img = hatching.Image()
+		}
+
+		if *stipple {
+			stippling, err = cld.Stipple(colidr.StippleOptions{
+				Points:     *stippleDots,
+				MinRadius:  *stippleMinR,
+				MaxRadius:  *stippleMaxR,
+				LineWeight: *stippleLine,
+			})
+			if err != nil {
+				log.Fatalf("error generating the stippling: %v", err)
+			}
+			img = stippling.Image()
+		}
+
+		if *kuwahara {
+			img, err = cld.Kuwahara(colidr.KuwaharaOptions{
+				Radius:    *kuwaharaR,
+				Sharpness: *kuwaharaQ,
+				Lines:     *kuwaharaLines,
+			})
+			if err != nil {
+				log.Fatalf("error applying the anisotropic Kuwahara filter: %v", err)
+			}
+		}
 	}
 
-	if *potrace {
+	if tracing {
 		*destination = strings.Replace(*destination, ext, ".bmp", 1)
 		ext = filepath.Ext(*destination)
 	}
@@ -115,41 +389,128 @@ func main() {
 
 	switch ext {
 	case ".jpg", ".jpeg":
-		err = jpeg.Encode(output, img, &jpeg.Options{Quality: 100})
+		err = jpeg.Encode(output, img, &jpeg.Options{Quality: *jpegQuality})
 	case ".png":
-		err = png.Encode(output, img)
+		enc := &png.Encoder{CompressionLevel: pngCompression}
+		err = enc.Encode(output, img)
+	case ".tif", ".tiff":
+		err = colidr.EncodeTIFF(output, img, &colidr.TIFFOptions{Compression: *tiffLevel})
+	case ".webp":
+		err = colidr.EncodeWebP(output, img)
+	case ".pbm":
+		err = colidr.EncodePBM(output, img)
+	case ".pgm":
+		if img == nil {
+			// Stream the tiled result, without loading it into memory.
+			err = tiled.EncodePGM(output)
+		} else {
+			err = colidr.EncodePGM(output, img)
+		}
+	case ".svg":
+		if stippling != nil {
+			err = stippling.EncodeSVG(output)
+		} else if hatching != nil {
+			err = hatching.EncodeSVG(output)
+		} else {
+			err = cld.Vectorize(*tolerance).EncodeSVG(output, vectorOpts)
+		}
+	case ".pdf":
+		err = cld.Vectorize(*tolerance).EncodePDF(output, vectorOpts)
+	case ".eps":
+		err = cld.Vectorize(*tolerance).EncodeEPS(output, vectorOpts)
 	case ".bmp":
-		done := make(chan bool)
-		go func(err error) {
-			err = bmp.Encode(output, img)
-			if err == nil {
-				done <- true
-			}
-		}(err)
-
-		if *potrace {
-		loop:
-			for {
-				select {
-				case <-done:
-					dest := filepath.Dir(*destination) + "/" + filepath.Base(strings.TrimSuffix(output.Name(), ".bmp")) + ".pgm"
-					args := []string{"-g", *destination, "-o", dest}
-
-					cmd := exec.Command("potrace", args...)
-
-					if _, err = cmd.Output(); err != nil {
-						fmt.Fprintln(os.Stderr, "potrace error: ", err)
-						os.Exit(1)
-					}
-					break loop
-				}
-			}
+		err = bmp.Encode(output, img)
+	}
+	if err != nil {
+		log.Fatalf("error encoding the image: %v", err)
+	}
+	if err := output.Close(); err != nil {
+		log.Fatalf("error saving the image: %v", err)
+	}
+
+	if tracing {
+		dest := filepath.Dir(*destination) + "/" + filepath.Base(strings.TrimSuffix(output.Name(), ".bmp")) + ".pgm"
+		args := []string{"-g", *destination, "-o", dest}
+
+		cmd := exec.Command("potrace", args...)
+
+		if _, err = cmd.Output(); err != nil {
+			fmt.Fprintln(os.Stderr, "potrace error: ", err)
+			os.Exit(1)
 		}
 	}
 	end := time.Now().Sub(start)
 	fmt.Printf("\nFinished in: %.2fs\n", end.Seconds())
 }
 
+// writeFlowViz saves the edge tangent flow visualization in PNG or SVG format, depending on the file extension.
+func writeFlowViz(fv *colidr.FlowViz, file string) error {
+	ext := filepath.Ext(file)
+	if !supportedFiles(ext, []string{".png", ".svg"}) {
+		return fmt.Errorf("visualization file type not supported: %v", ext)
+	}
+	output, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	if ext == ".svg" {
+		return fv.EncodeSVG(output)
+	}
+	return fv.EncodePNG(output)
+}
+
+// writeRaw saves the raw FDoG field in 32-bit float TIFF or PFM format, depending on the file extension.
+func writeRaw(cld *colidr.Cld, file, compression string) error {
+	fdog, err := cld.FDoG()
+	if err != nil {
+		return err
+	}
+	output, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	if filepath.Ext(file) == ".pfm" {
+		return fdog.EncodePFM(output)
+	}
+	return fdog.EncodeTIFF(output, &colidr.TIFFOptions{Compression: compression})
+}
+
+// parseColor parses a colour given in the #rrggbb hexadecimal format.
+// It returns a nil colour for none.
+func parseColor(s string) (color.Color, error) {
+	if s == "none" {
+		return nil, nil
+	}
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(strings.TrimPrefix(s, "#"), "%02x%02x%02x", &r, &g, &b); err != nil {
+		return nil, fmt.Errorf("the colour should be defined as #rrggbb")
+	}
+	return color.NRGBA{R: r, G: g, B: b, A: 255}, nil
+}
+
+// parseParamMap parses a parameter map definition given in the min:max:image format.
+func parseParamMap(s string) (colidr.ParamMap, error) {
+	var pm colidr.ParamMap
+
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 {
+		return pm, fmt.Errorf("the parameter map should be defined as min:max:image")
+	}
+	lo, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return pm, err
+	}
+	hi, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return pm, err
+	}
+	return colidr.ParamMap{File: parts[2], Min: lo, Max: hi}, nil
+}
+
 // supportedFiles checks if the provided file extension is supported.
 func supportedFiles(ext string, types []string) bool {
 	for _, t := range types {
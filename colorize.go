@@ -0,0 +1,164 @@
+package colidr
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// The supported line coloring modes.
+const (
+	InkSolid  = "solid"
+	InkSource = "source"
+	InkPencil = "pencil"
+)
+
+// defaultPencilLength is the default length of the flow aligned color smoothing.
+const defaultPencilLength = 8
+
+// InkOptions contains the options of the colored line drawing output.
+type InkOptions struct {
+	// Mode is either InkSolid, using the provided color, InkSource, sampling the color from the source image,
+	// or InkPencil, sampling a darkened color from the source image smoothed along the flow. Defaults to InkSolid.
+	Mode string
+	// Color is the line color used by the InkSolid mode. If it's nil the lines are black.
+	Color color.Color
+	// Transparent makes the background transparent, the alpha channel being derived from the line intensity.
+	// Otherwise the lines are drawn over a white background.
+	Transparent bool
+	// Darken is the darkening factor in the [0, 1] range applied to the colors of the InkPencil mode.
+	Darken float64
+	// Length is the length in pixels of the flow aligned color smoothing of the InkPencil mode. Defaults to 8.
+	Length int
+}
+
+// Ink returns the line drawing as an RGBA image, the lines being colored according to the provided options.
+// The ink coverage of each pixel is given by the (possibly anti-aliased) line intensity,
+// so it should be called after GenerateCld.
+func (c *Cld) Ink(opts InkOptions) (*image.NRGBA, error) {
+	if opts.Mode == "" {
+		opts.Mode = InkSolid
+	}
+	ink := color.NRGBA{A: 255}
+	if opts.Color != nil {
+		ink = color.NRGBAModel.Convert(opts.Color).(color.NRGBA)
+	}
+
+	width, height := c.result.Cols(), c.result.Rows()
+	data := c.result.ToBytes()
+
+	var sample func(i int) color.NRGBA
+	switch opts.Mode {
+	case InkSolid:
+		sample = func(int) color.NRGBA { return ink }
+	case InkSource:
+		src := c.source.ToBytes()
+		sample = func(i int) color.NRGBA {
+			return color.NRGBA{R: src[3*i+2], G: src[3*i+1], B: src[3*i], A: 255}
+		}
+	case InkPencil:
+		if opts.Darken < 0 || opts.Darken > 1 {
+			return nil, fmt.Errorf("the darkening factor should be in the [0, 1] range")
+		}
+		if opts.Length <= 0 {
+			opts.Length = defaultPencilLength
+		}
+		colors, err := c.pencilColors(data, opts.Length, opts.Darken)
+		if err != nil {
+			return nil, err
+		}
+		sample = func(i int) color.NRGBA { return colors[i] }
+	default:
+		return nil, fmt.Errorf("unsupported ink mode: %s", opts.Mode)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for i, v := range data {
+		coverage := 255 - uint32(v)
+		col := sample(i)
+		pix := dst.Pix[4*i : 4*i+4]
+
+		if opts.Transparent {
+			pix[0], pix[1], pix[2] = col.R, col.G, col.B
+			pix[3] = uint8(coverage * uint32(col.A) / 255)
+			continue
+		}
+		// Blend the line color over the white background.
+		alpha := coverage * uint32(col.A) / 255
+		pix[0] = blendOverWhite(col.R, alpha)
+		pix[1] = blendOverWhite(col.G, alpha)
+		pix[2] = blendOverWhite(col.B, alpha)
+		pix[3] = 255
+	}
+	return dst, nil
+}
+
+// blendOverWhite blends the color component over white with the provided alpha.
+func blendOverWhite(c uint8, alpha uint32) uint8 {
+	return uint8((uint32(c)*alpha + 255*(255-alpha)) / 255)
+}
+
+// pencilColors returns the colors of the ink pixels, obtained by averaging the smoothed source image colors
+// along the edge tangent flow streamline passing through the pixel and darkening them by the provided factor.
+func (c *Cld) pencilColors(data []byte, length int, darken float64) ([]color.NRGBA, error) {
+	ff, err := c.FlowField()
+	if err != nil {
+		return nil, err
+	}
+	blurred := gocv.NewMat()
+	defer blurred.Close()
+	gocv.GaussianBlur(c.source, &blurred, image.Point{5, 5}, 0, 0, gocv.BorderReplicate)
+	src := blurred.ToBytes()
+
+	width, height := ff.Width, ff.Height
+	colors := make([]color.NRGBA, width*height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			idx := y*width + x
+			if data[idx] == 255 {
+				continue
+			}
+			var r, g, b float64
+			n := 0
+			add := func(i int) {
+				b += float64(src[3*i])
+				g += float64(src[3*i+1])
+				r += float64(src[3*i+2])
+				n++
+			}
+			add(idx)
+
+			// Follow the streamline in both directions, keeping the direction consistent between the steps.
+			tx, ty := ff.At(x, y)
+			for _, sign := range []float32{1, -1} {
+				px, py := float64(x), float64(y)
+				prevX, prevY := sign*tx, sign*ty
+				for s := 0; s < length; s++ {
+					dx, dy := ff.Sample(px, py)
+					if dx*prevX+dy*prevY < 0 {
+						dx, dy = -dx, -dy
+					}
+					if dx == 0 && dy == 0 {
+						break
+					}
+					px, py = px+float64(dx), py+float64(dy)
+					sx, sy := int(math.Round(px)), int(math.Round(py))
+					if sx < 0 || sx >= width || sy < 0 || sy >= height {
+						break
+					}
+					add(sy*width + sx)
+					prevX, prevY = dx, dy
+				}
+			}
+
+			f := (1 - darken) / float64(n)
+			colors[idx] = color.NRGBA{R: uint8(r * f), G: uint8(g * f), B: uint8(b * f), A: 255}
+		}
+	}
+	return colors, nil
+}
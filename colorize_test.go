@@ -0,0 +1,56 @@
+package colidr
+
+import (
+	"image/color"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestCld_Ink(t *testing.T) {
+	c := newTestCld(4, testOptions())
+	c.result.SetTo(gocv.NewScalar(255, 0, 0, 0))
+	c.result.SetUCharAt(1, 1, 0)
+	c.result.SetUCharAt(1, 2, 128)
+	c.source.SetTo(gocv.NewScalar(10, 20, 30, 0))
+
+	red := color.NRGBA{R: 255, A: 255}
+	img, err := c.Ink(InkOptions{Color: red, Transparent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if col := img.NRGBAAt(1, 1); col != red {
+		t.Errorf("expected an opaque ink pixel, got %v", col)
+	}
+	if col := img.NRGBAAt(2, 1); col.A != 127 {
+		t.Errorf("expected a semi-transparent anti-aliased pixel, got %v", col)
+	}
+	if col := img.NRGBAAt(0, 0); col.A != 0 {
+		t.Errorf("expected a transparent background pixel, got %v", col)
+	}
+
+	img, err = c.Ink(InkOptions{Mode: InkSource})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The source matrix holds the color components in BGR order.
+	if col := img.NRGBAAt(1, 1); col != (color.NRGBA{R: 30, G: 20, B: 10, A: 255}) {
+		t.Errorf("expected the source color, got %v", col)
+	}
+	if col := img.NRGBAAt(0, 0); col != (color.NRGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Errorf("expected a white background pixel, got %v", col)
+	}
+
+	// The uniform source image colors are only darkened by the pencil mode.
+	img, err = c.Ink(InkOptions{Mode: InkPencil, Darken: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if col := img.NRGBAAt(1, 1); col != (color.NRGBA{R: 15, G: 10, B: 5, A: 255}) {
+		t.Errorf("expected the darkened source color, got %v", col)
+	}
+
+	if _, err := c.Ink(InkOptions{Mode: "crayon"}); err == nil {
+		t.Error("expected an error for the unsupported ink mode")
+	}
+}
@@ -0,0 +1,170 @@
+package colidr
+
+import "math"
+
+// component holds the statistics of a connected ink region.
+type component struct {
+	area                int
+	sumX, sumY          float64
+	sumXX, sumYY, sumXY float64
+}
+
+// add updates the component statistics with a new pixel.
+func (cc *component) add(x, y int) {
+	fx, fy := float64(x), float64(y)
+	cc.area++
+	cc.sumX += fx
+	cc.sumY += fy
+	cc.sumXX += fx * fx
+	cc.sumYY += fy * fy
+	cc.sumXY += fx * fy
+}
+
+// elongation returns the ratio between the major and minor axis of the component,
+// computed from the eigenvalues of its second order central moments.
+// A perfectly straight line has an infinite elongation, a disc has an elongation of 1.
+func (cc *component) elongation() float64 {
+	n := float64(cc.area)
+	mx, my := cc.sumX/n, cc.sumY/n
+	cxx := cc.sumXX/n - mx*mx
+	cyy := cc.sumYY/n - my*my
+	cxy := cc.sumXY/n - mx*my
+
+	d := math.Sqrt((cxx-cyy)*(cxx-cyy) + 4*cxy*cxy)
+	l1 := (cxx + cyy + d) / 2
+	l2 := (cxx + cyy - d) / 2
+
+	if l2 <= 1e-9 {
+		if l1 <= 1e-9 {
+			// Single pixel component.
+			return 1.0
+		}
+		return math.Inf(1)
+	}
+	return math.Sqrt(l1 / l2)
+}
+
+// labelComponents labels the 8-connected ink (black) regions of the binary image.
+// It returns the label of each pixel (-1 for the background) and the components statistics.
+func labelComponents(data []uint8, width, height int) ([]int, []component) {
+	labels := make([]int, len(data))
+	for i := range labels {
+		labels[i] = -1
+	}
+
+	var (
+		components []component
+		stack      []int
+	)
+	for i, v := range data {
+		if v != 0 || labels[i] != -1 {
+			continue
+		}
+		label := len(components)
+		cc := component{}
+
+		labels[i] = label
+		stack = append(stack[:0], i)
+		for len(stack) > 0 {
+			idx := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			x, y := idx%width, idx/width
+			cc.add(x, y)
+
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || nx > width-1 || ny < 0 || ny > height-1 {
+						continue
+					}
+					n := ny*width + nx
+					if data[n] == 0 && labels[n] == -1 {
+						labels[n] = label
+						stack = append(stack, n)
+					}
+				}
+			}
+		}
+		components = append(components, cc)
+	}
+	return labels, components
+}
+
+// cleanup removes the small or blob-like connected components from the binary result
+// and optionally bridges the small gaps between the components along the edge tangent flow.
+func (c *Cld) cleanup() {
+	if c.MinComponentArea == 0 && c.MinElongation == 0 && c.BridgeGap == 0 {
+		return
+	}
+	width, height := c.result.Cols(), c.result.Rows()
+	data := c.result.DataPtrUint8()
+	c.meta.RemovedComponents = 0
+
+	if c.BridgeGap > 0 {
+		labels, _ := labelComponents(data, width, height)
+		c.bridgeGaps(data, labels, width, height)
+	}
+
+	labels, components := labelComponents(data, width, height)
+	removed := make([]bool, len(components))
+	for i := range components {
+		cc := &components[i]
+		if cc.area < c.MinComponentArea || (c.MinElongation > 0 && cc.elongation() < c.MinElongation) {
+			removed[i] = true
+			c.meta.RemovedComponents++
+		}
+	}
+	for i, label := range labels {
+		if label != -1 && removed[label] {
+			data[i] = 255
+		}
+	}
+}
+
+// bridgeGaps closes the gaps shorter than the BridgeGap value between two different components,
+// by following the edge tangent flow direction from each ink pixel.
+func (c *Cld) bridgeGaps(data []uint8, labels []int, width, height int) {
+	var gap []int
+	flow, _ := c.etf.flowField.DataPtrFloat32()
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			label := labels[y*width+x]
+			if label == -1 {
+				continue
+			}
+			idx := 3 * (y*width + x)
+			direction := position{x: float64(flow[idx+1]), y: float64(flow[idx])}
+			if direction.x == 0 && direction.y == 0 {
+				continue
+			}
+
+			for _, sign := range []float64{1, -1} {
+				gap = gap[:0]
+				for step := 1; step <= c.BridgeGap+1; step++ {
+					col := int(math.Round(float64(x) + sign*direction.x*float64(step)))
+					row := int(math.Round(float64(y) + sign*direction.y*float64(step)))
+					if row < 0 || row > height-1 || col < 0 || col > width-1 {
+						break
+					}
+					idx := row*width + col
+					if labels[idx] == label {
+						if len(gap) > 0 {
+							break
+						}
+						continue
+					}
+					if labels[idx] != -1 {
+						// Reached a different component: fill the gap.
+						for _, g := range gap {
+							data[g] = 0
+						}
+						break
+					}
+					gap = append(gap, idx)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package colidr
+
+import (
+	"math"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// binaryImage returns a white image of the provided size, having ink at the listed pixels.
+func binaryImage(width, height int, ink ...[2]int) []uint8 {
+	data := make([]uint8, width*height)
+	for i := range data {
+		data[i] = 255
+	}
+	for _, p := range ink {
+		data[p[1]*width+p[0]] = 0
+	}
+	return data
+}
+
+func TestLabelComponents(t *testing.T) {
+	// A diagonal line is a single 8-connected component, the isolated pixel is a separate one.
+	data := binaryImage(8, 8, [2]int{0, 0}, [2]int{1, 1}, [2]int{2, 2}, [2]int{3, 3}, [2]int{6, 1})
+	labels, components := labelComponents(data, 8, 8)
+
+	if len(components) != 2 {
+		t.Fatalf("expected 2 components, got %d", len(components))
+	}
+	if labels[0] != labels[3*8+3] || labels[0] == labels[1*8+6] {
+		t.Errorf("expected the diagonal pixels to share a label different from the isolated pixel, got %v", labels)
+	}
+	if components[labels[0]].area != 4 || components[labels[1*8+6]].area != 1 {
+		t.Errorf("expected component areas 4 and 1, got %d and %d", components[labels[0]].area, components[labels[1*8+6]].area)
+	}
+	if labels[1] != -1 {
+		t.Errorf("expected the background label -1, got %d", labels[1])
+	}
+}
+
+func TestComponent_Elongation(t *testing.T) {
+	var line, blob, dot component
+	for i := 0; i < 10; i++ {
+		line.add(i, 2)
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			blob.add(x, y)
+		}
+	}
+	dot.add(3, 3)
+
+	if e := line.elongation(); !math.IsInf(e, 1) {
+		t.Errorf("expected an infinite elongation for a straight line, got %v", e)
+	}
+	if e := blob.elongation(); math.Abs(e-1) > 1e-9 {
+		t.Errorf("expected an elongation of 1 for a square blob, got %v", e)
+	}
+	if e := dot.elongation(); e != 1 {
+		t.Errorf("expected an elongation of 1 for a single pixel, got %v", e)
+	}
+}
+
+func TestCld_BridgeGaps(t *testing.T) {
+	// The uniform flow is vertical, so only the vertical gaps are bridged.
+	for _, tc := range []struct {
+		name     string
+		ink      [][2]int
+		bridge   int
+		gap      [2]int
+		expected uint8
+	}{
+		{"along the flow", [][2]int{{8, 4}, {8, 5}, {8, 9}, {8, 10}}, 4, [2]int{8, 7}, 0},
+		{"too long", [][2]int{{8, 4}, {8, 5}, {8, 9}, {8, 10}}, 2, [2]int{8, 7}, 255},
+		{"across the flow", [][2]int{{4, 8}, {5, 8}, {9, 8}, {10, 8}}, 4, [2]int{7, 8}, 255},
+	} {
+		opts := testOptions()
+		opts.BridgeGap = tc.bridge
+		c := newTestCld(16, opts)
+		c.etf = newUniformEtf(16, gocv.Vecf{1, 0, 0}, 1)
+
+		data := binaryImage(16, 16, tc.ink...)
+		labels, _ := labelComponents(data, 16, 16)
+		c.bridgeGaps(data, labels, 16, 16)
+
+		if v := data[tc.gap[1]*16+tc.gap[0]]; v != tc.expected {
+			t.Errorf("%s: expected %d in the gap, got %d", tc.name, tc.expected, v)
+		}
+	}
+}
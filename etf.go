@@ -1,9 +1,9 @@
 package colidr
 
 import (
+	"fmt"
 	"image"
 	"math"
-	"sync"
 
 	"gocv.io/x/gocv"
 )
@@ -15,8 +15,17 @@ type Etf struct {
 	gradientField gocv.Mat
 	refinedEtf    gocv.Mat
 	gradientMag   gocv.Mat
-	wg            sync.WaitGroup
-	mu            sync.RWMutex
+	mask          *gocv.Mat
+	norm          *etfNorm
+	operator      GradientOperator
+	separable     bool
+}
+
+// etfNorm holds the value ranges of the whole image, used in place of the ranges of the processed matrix
+// when the edge tangent flow is computed tile by tile.
+type etfNorm struct {
+	srcMin, srcMax float64
+	magMin, magMax float64
 }
 
 // point is a basic struct for vector type operations
@@ -40,12 +49,69 @@ func (etf *Etf) Init(rows, cols int) {
 
 // InitDefaultEtf computes the gradientField matrix by setting up
 // the pixel values from original image on which a sobel threshold has been applied.
+// If a gradient operator has been set, the gradient is computed by the pure Go operator instead.
 func (etf *Etf) InitDefaultEtf(file string, size image.Point) error {
+	img, err := LoadImage(file, nil)
+	if err != nil {
+		return fmt.Errorf("unable to read the image: %s", err)
+	}
+	src := imageToMat(img)
+	defer src.Close()
+
+	return etf.InitFromMat(src, size)
+}
+
+// InitFromMat computes the gradientField matrix from a BGR color matrix, like InitDefaultEtf.
+func (etf *Etf) InitFromMat(img gocv.Mat, size image.Point) error {
 	etf.resizeMat(size)
 
-	src := gocv.IMRead(file, gocv.IMReadColor)
-	src.ConvertTo(&src, gocv.MatTypeCV32F, 255)
-	gocv.Normalize(src, &src, 0.0, 1.0, gocv.NormMinMax)
+	src := img.Clone()
+	defer src.Close()
+
+	if etf.operator != "" {
+		gocv.Resize(src, &src, size, 0, 0, gocv.InterpolationLinear)
+
+		img, err := src.ToImage()
+		if err != nil {
+			return err
+		}
+		etf.InitFromGradient(Gradient(img, etf.operator))
+		return nil
+	}
+	gradX, gradY := etf.sobel(src)
+	defer gradX.Close()
+	defer gradY.Close()
+
+	if etf.norm != nil {
+		normalizeRange(&etf.gradientMag, etf.norm.magMin, etf.norm.magMax)
+	} else {
+		gocv.Normalize(etf.gradientMag, &etf.gradientMag, 0.0, 1.0, gocv.NormMinMax)
+	}
+
+	u, _ := gradX.DataPtrFloat32()
+	v, _ := gradY.DataPtrFloat32()
+	field, _ := etf.gradientField.DataPtrFloat32()
+
+	for i := 0; i < len(field); i += 3 {
+		field[i], field[i+1], field[i+2] = v[i], u[i], 0
+	}
+	etf.rotateFlow(&etf.gradientField, &etf.flowField, 90)
+
+	return nil
+}
+
+// sobel computes the horizontal and vertical derivatives of the BGR color matrix with the OpenCV Sobel operator.
+// Their magnitude is stored in the gradientMag matrix, without being normalized.
+func (etf *Etf) sobel(img gocv.Mat) (gocv.Mat, gocv.Mat) {
+	src := gocv.NewMat()
+	defer src.Close()
+
+	img.ConvertTo(&src, gocv.MatTypeCV32F, 255)
+	if etf.norm != nil {
+		normalizeRange(&src, etf.norm.srcMin, etf.norm.srcMax)
+	} else {
+		gocv.Normalize(src, &src, 0.0, 1.0, gocv.NormMinMax)
+	}
 
 	// Generate gradX and gradY
 	gradX := gocv.NewMatWithSize(src.Rows(), src.Cols(), gocv.MatTypeCV32F)
@@ -56,52 +122,185 @@ func (etf *Etf) InitDefaultEtf(file string, size image.Point) error {
 
 	// Compute gradient
 	gocv.Magnitude(gradX, gradY, &etf.gradientMag)
-	gocv.Normalize(etf.gradientMag, &etf.gradientMag, 0.0, 1.0, gocv.NormMinMax)
 
-	width, height := src.Cols(), src.Rows()
-	etf.wg.Add(width * height)
+	return gradX, gradY
+}
+
+// normalizeRange linearly maps the values of the float matrix from the [lo, hi] range to the [0, 1] range.
+func normalizeRange(m *gocv.Mat, lo, hi float64) {
+	data, err := m.DataPtrFloat32()
+	if err != nil || hi <= lo {
+		return
+	}
+	scale := 1.0 / (hi - lo)
+	for i, v := range data {
+		data[i] = float32((float64(v) - lo) * scale)
+	}
+}
 
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			go func(y, x int) {
-				etf.mu.RLock()
-				defer etf.mu.RUnlock()
+// SetGradientOperator sets the pure Go gradient operator used by InitDefaultEtf.
+// An empty operator falls back to the OpenCV Sobel operator.
+func (etf *Etf) SetGradientOperator(op GradientOperator) {
+	etf.operator = op
+}
 
-				u := gradX.GetVecfAt(y, x)
-				v := gradY.GetVecfAt(y, x)
+// InitFromGradient initializes the gradient field, the gradient magnitude
+// and the flow field from a gradient computed by one of the pure Go operators.
+func (etf *Etf) InitFromGradient(g *GradientField) {
+	size := image.Point{X: g.Width, Y: g.Height}
+	etf.resizeMat(size)
 
-				etf.gradientField.SetVecfAt(y, x, gocv.Vecf{v[0], u[0], 0})
-				etf.wg.Done()
-			}(y, x)
+	var maxMag float64
+	if etf.norm != nil {
+		maxMag = etf.norm.magMax
+	} else {
+		for _, m := range g.Magnitude {
+			maxMag = math.Max(maxMag, m)
 		}
 	}
 
-	etf.wg.Wait()
-	etf.rotateFlow(&etf.gradientField, &etf.flowField, 90)
+	field, _ := etf.gradientField.DataPtrFloat32()
+	magnitude, _ := etf.gradientMag.DataPtrFloat32()
 
-	return nil
+	for i, m := range g.Magnitude {
+		field[3*i], field[3*i+1], field[3*i+2] = float32(g.Y[i]), float32(g.X[i]), 0
+
+		var mag float32
+		if maxMag > 0 {
+			mag = float32(m / maxMag)
+		}
+		magnitude[3*i], magnitude[3*i+1], magnitude[3*i+2] = mag, mag, mag
+	}
+	etf.rotateFlow(&etf.gradientField, &etf.flowField, 90)
 }
 
 // RefineEtf will compute the refined edge tangent flow
 // based on the formulas from the original paper.
+// If the separable refinement is enabled, the kernel is applied in a horizontal and a vertical pass,
+// like in the fast variant described by the paper.
 func (etf *Etf) RefineEtf(kernel int) {
+	if etf.separable {
+		etf.refine(lineOffsets(kernel, point{1, 0}))
+		etf.refinedEtf.CopyTo(&etf.flowField)
+		etf.refine(lineOffsets(kernel, point{0, 1}))
+	} else {
+		etf.refine(circleOffsets(kernel))
+	}
+	etf.refinedEtf.CopyTo(&etf.flowField)
+}
+
+// SetSeparable enables the separable refinement, a faster approximation of the circular kernel.
+func (etf *Etf) SetSeparable(separable bool) {
+	etf.separable = separable
+}
+
+// refine computes the refined edge tangent flow over the neighbourhood given by the offsets,
+// the same way as computeNewVector does, but accessing the matrix data directly.
+func (etf *Etf) refine(offsets []point) {
 	width, height := etf.flowField.Cols(), etf.flowField.Rows()
-	etf.wg.Add(width * height)
-
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			// Spawn computation into separate goroutines
-			go func(y, x int) {
-				etf.mu.Lock()
-				etf.computeNewVector(x, y, kernel)
-				etf.mu.Unlock()
-
-				etf.wg.Done()
-			}(y, x)
+
+	flow, _ := etf.flowField.DataPtrFloat32()
+	refined, _ := etf.refinedEtf.DataPtrFloat32()
+	mag, _ := etf.gradientMag.DataPtrFloat32()
+
+	// The magnitude of a pixel is averaged over the color channels, like magnitudeAt returns it.
+	avgMag := make([]float32, width*height)
+	for i := range avgMag {
+		avgMag[i] = (mag[3*i] + mag[3*i+1] + mag[3*i+2]) / 3
+	}
+
+	var mask []float32
+	if etf.mask != nil {
+		mask, _ = etf.mask.DataPtrFloat32()
+	}
+
+	parallelRows(height, func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := 0; x < width; x++ {
+				idx := 3 * (y*width + x)
+				t0, t1, t2 := flow[idx], flow[idx+1], flow[idx+2]
+				m := avgMag[y*width+x]
+
+				var tNew0, tNew1, tNew2 float32
+				for _, o := range offsets {
+					r, c := y+o.y, x+o.x
+					if r < 0 || r >= height || c < 0 || c >= width {
+						continue
+					}
+					i := 3 * (r*width + c)
+					u0, u1, u2 := flow[i], flow[i+1], flow[i+2]
+
+					// The product of phi and of the direction weight is the dot product itself.
+					w := (t0*u0 + t1*u1 + t2*u2) * magnitudeWeight(m-avgMag[r*width+c])
+					tNew0 += u0 * w
+					tNew1 += u1 * w
+					tNew2 += u2 * w
+				}
+
+				// Outside of the mask keep the original flow, blending it with the refined one along the feathered edges.
+				if mask != nil {
+					if w := mask[y*width+x]; w < 1.0 {
+						tNew := etf.normalize(tNew0, tNew1, tNew2)
+						tNew0 = w*tNew[0] + (1.0-w)*t0
+						tNew1 = w*tNew[1] + (1.0-w)*t1
+						tNew2 = w*tNew[2] + (1.0-w)*t2
+					}
+				}
+				v := etf.normalize(tNew0, tNew1, tNew2)
+				refined[idx], refined[idx+1], refined[idx+2] = v[0], v[1], v[2]
+			}
+		}
+	})
+}
+
+// circleOffsets returns the offsets of the neighbours closer than the kernel radius,
+// the ones having a spatial weight of 1 in the paper's Eq(2).
+func circleOffsets(kernel int) []point {
+	var offsets []point
+	for dy := -kernel; dy <= kernel; dy++ {
+		for dx := -kernel; dx <= kernel; dx++ {
+			if dx*dx+dy*dy < kernel*kernel {
+				offsets = append(offsets, point{dx, dy})
+			}
 		}
 	}
-	etf.wg.Wait()
-	etf.flowField = etf.refinedEtf.Clone()
+	return offsets
+}
+
+// lineOffsets returns the offsets of the neighbours closer than the kernel radius along the direction.
+func lineOffsets(kernel int, dir point) []point {
+	var offsets []point
+	for d := -kernel + 1; d < kernel; d++ {
+		offsets = append(offsets, point{d * dir.x, d * dir.y})
+	}
+	return offsets
+}
+
+// magWeightSteps is the number of magnitude weight table entries for a unit magnitude difference.
+const magWeightSteps = 512
+
+// magWeightTable holds the magnitude weights of the paper's Eq(3) for the magnitude differences in the [-1, 1] range.
+var magWeightTable = func() []float32 {
+	table := make([]float32, 2*magWeightSteps+1)
+	for i := range table {
+		d := float64(i-magWeightSteps) / magWeightSteps
+		table[i] = float32((1.0 + math.Tanh(d)) / 2.0)
+	}
+	return table
+}()
+
+// magnitudeWeight returns the magnitude weight of the paper's Eq(3), interpolated from the lookup table.
+// The normalized magnitudes are in the [0, 1] range, so their difference falls into the table.
+func magnitudeWeight(diff float32) float32 {
+	if diff <= -1 || diff >= 1 {
+		return (1.0 + float32(math.Tanh(float64(diff)))) / 2.0
+	}
+	f := (diff + 1) * magWeightSteps
+	i := int(f)
+	if i >= 2*magWeightSteps {
+		return magWeightTable[2*magWeightSteps]
+	}
+	return magWeightTable[i] + (magWeightTable[i+1]-magWeightTable[i])*(f-float32(i))
 }
 
 // resizeMat resize all the matrices
@@ -116,31 +315,22 @@ func (etf *Etf) resizeMat(size image.Point) {
 func (etf *Etf) rotateFlow(src, dst *gocv.Mat, theta float64) {
 	theta = theta / 180.0 * math.Pi
 
-	width, height := src.Cols(), src.Rows()
-	etf.wg.Add(width * height)
-
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			go func(y, x int) {
-				etf.mu.Lock()
-				defer etf.mu.Unlock()
+	cos, sin := math.Cos(theta), math.Sin(theta)
 
-				v := src.GetVecfAt(y, x)
+	srcData, _ := src.DataPtrFloat32()
+	dstData, _ := dst.DataPtrFloat32()
 
-				// Obtain the vector value and rotate it.
-				rx := float64(v[0])*math.Cos(theta) - float64(v[1])*math.Sin(theta)
-				ry := float64(v[0])*math.Sin(theta) + float64(v[1])*math.Cos(theta)
+	for i := 0; i < len(srcData); i += 3 {
+		// Obtain the vector value and rotate it.
+		rx := float64(srcData[i])*cos - float64(srcData[i+1])*sin
+		ry := float64(srcData[i])*sin + float64(srcData[i+1])*cos
 
-				dst.SetVecfAt(y, x, gocv.Vecf{float32(rx), float32(ry), 0})
-
-				etf.wg.Done()
-			}(y, x)
-		}
+		dstData[i], dstData[i+1], dstData[i+2] = float32(rx), float32(ry), 0
 	}
-	etf.wg.Wait()
 }
 
 // computeNewVector computes a new, normalized vector from the refined edge tangent flow matrix following the original paper Eq(1).
+// It's the reference implementation of the refinement done by RefineEtf.
 func (etf *Etf) computeNewVector(x, y int, kernel int) {
 	var tNew0, tNew1, tNew2 float32
 	tCurX := etf.flowField.GetVecfAt(y, x)
@@ -156,7 +346,7 @@ func (etf *Etf) computeNewVector(x, y int, kernel int) {
 			phi := etf.computePhi(tCurX, tCurY)
 			// Compute the euclidean distance of the current point and the neighborhood point.
 			ws := etf.computeWeightSpatial(point{x, y}, point{c, r}, kernel)
-			wm := etf.computeWeightMagnitude(etf.gradientMag.GetFloatAt(y, x), etf.gradientMag.GetFloatAt(r, c))
+			wm := etf.computeWeightMagnitude(etf.magnitudeAt(x, y), etf.magnitudeAt(c, r))
 			wd := etf.computeWeightDirection(tCurX, tCurY)
 
 			tNew0 += phi * tCurY[0] * ws * wm * wd
@@ -165,6 +355,15 @@ func (etf *Etf) computeNewVector(x, y int, kernel int) {
 		}
 	}
 
+	// Outside of the mask keep the original flow, blending it with the refined one along the feathered edges.
+	if etf.mask != nil {
+		if w := etf.mask.GetFloatAt(y, x); w < 1.0 {
+			tNew := etf.normalize(tNew0, tNew1, tNew2)
+			tNew0 = w*tNew[0] + (1.0-w)*tCurX[0]
+			tNew1 = w*tNew[1] + (1.0-w)*tCurX[1]
+			tNew2 = w*tNew[2] + (1.0-w)*tCurX[2]
+		}
+	}
 	etf.refinedEtf.SetVecfAt(y, x, etf.normalize(tNew0, tNew1, tNew2))
 }
 
@@ -211,6 +410,12 @@ func (etf *Etf) computeDot(x, y gocv.Vecf) float32 {
 	return s
 }
 
+// magnitudeAt returns the normalized gradient magnitude averaged over the color channels.
+func (etf *Etf) magnitudeAt(x, y int) float32 {
+	v := etf.gradientMag.GetVecfAt(y, x)
+	return (v[0] + v[1] + v[2]) / 3.0
+}
+
 // normalize returns a normalized vector
 func (etf *Etf) normalize(x, y, z float32) gocv.Vecf {
 	nv := float32(math.Sqrt(float64(x*x) + float64(y*y) + float64(z*z)))
@@ -0,0 +1,259 @@
+package colidr
+
+import (
+	"math"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// newUniformEtf returns an Etf with a constant flow field and gradient magnitude.
+func newUniformEtf(size int, flow gocv.Vecf, mag float32) *Etf {
+	etf := NewETF()
+	etf.Init(size, size)
+	etf.flowField.SetTo(gocv.NewScalar(float64(flow[0]), float64(flow[1]), float64(flow[2]), 0))
+	etf.gradientMag.SetTo(gocv.NewScalar(float64(mag), float64(mag), float64(mag), 0))
+	return etf
+}
+
+func TestEtf_ComputeWeightSpatial(t *testing.T) {
+	etf := NewETF()
+
+	if w := etf.computeWeightSpatial(point{0, 0}, point{1, 1}, 3); w != 1.0 {
+		t.Errorf("expected weight 1 inside the kernel radius, got %v", w)
+	}
+	if w := etf.computeWeightSpatial(point{0, 0}, point{3, 0}, 3); w != 0.0 {
+		t.Errorf("expected weight 0 on the kernel radius, got %v", w)
+	}
+	if w := etf.computeWeightSpatial(point{0, 0}, point{3, 3}, 3); w != 0.0 {
+		t.Errorf("expected weight 0 outside the kernel radius, got %v", w)
+	}
+}
+
+func TestEtf_ComputeWeightMagnitude(t *testing.T) {
+	etf := NewETF()
+
+	if w := etf.computeWeightMagnitude(0.5, 0.5); w != 0.5 {
+		t.Errorf("expected weight 0.5 for equal magnitudes, got %v", w)
+	}
+	expected := float32((1 + math.Tanh(1)) / 2)
+	if w := etf.computeWeightMagnitude(1, 0); math.Abs(float64(w-expected)) > 1e-6 {
+		t.Errorf("expected weight %v, got %v", expected, w)
+	}
+	if etf.computeWeightMagnitude(1, 0) <= etf.computeWeightMagnitude(0, 1) {
+		t.Error("expected a larger weight for the neighbours with a smaller magnitude")
+	}
+}
+
+func TestEtf_ComputeWeightDirectionAndPhi(t *testing.T) {
+	etf := newUniformEtf(4, gocv.Vecf{1, 0, 0}, 1)
+
+	x := gocv.Vecf{1, 0, 0}
+	same := gocv.Vecf{1, 0, 0}
+	opposite := gocv.Vecf{-1, 0, 0}
+	orthogonal := gocv.Vecf{0, 1, 0}
+
+	if d := etf.computeDot(x, gocv.Vecf{0.5, 2, 0}); d != 0.5 {
+		t.Errorf("expected dot product 0.5, got %v", d)
+	}
+	if w := etf.computeWeightDirection(x, same); w != 1.0 {
+		t.Errorf("expected direction weight 1 for parallel vectors, got %v", w)
+	}
+	if w := etf.computeWeightDirection(x, opposite); w != 1.0 {
+		t.Errorf("expected direction weight 1 for opposite vectors, got %v", w)
+	}
+	if w := etf.computeWeightDirection(x, orthogonal); w != 0.0 {
+		t.Errorf("expected direction weight 0 for orthogonal vectors, got %v", w)
+	}
+	if phi := etf.computePhi(x, same); phi != 1.0 {
+		t.Errorf("expected phi 1 for parallel vectors, got %v", phi)
+	}
+	if phi := etf.computePhi(x, opposite); phi != -1.0 {
+		t.Errorf("expected phi -1 for opposite vectors, got %v", phi)
+	}
+}
+
+func TestEtf_Normalize(t *testing.T) {
+	etf := NewETF()
+
+	v := etf.normalize(3, 4, 0)
+	if math.Abs(float64(v[0])-0.6) > 1e-6 || math.Abs(float64(v[1])-0.8) > 1e-6 || v[2] != 0 {
+		t.Errorf("expected normalized vector (0.6, 0.8, 0), got %v", v)
+	}
+	if v := etf.normalize(0, 0, 0); v[0] != 0 || v[1] != 0 || v[2] != 0 {
+		t.Errorf("expected zero vector, got %v", v)
+	}
+}
+
+func TestEtf_ComputeNewVector(t *testing.T) {
+	flow := gocv.Vecf{0.6, 0.8, 0}
+	etf := newUniformEtf(8, flow, 0.5)
+
+	// A uniform flow field should remain unchanged after the refinement.
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			etf.computeNewVector(x, y, 3)
+			v := etf.refinedEtf.GetVecfAt(y, x)
+			for i := range v {
+				if math.Abs(float64(v[i]-flow[i])) > 1e-5 {
+					t.Fatalf("expected refined vector %v at (%d, %d), got %v", flow, x, y, v)
+				}
+			}
+		}
+	}
+}
+
+func TestMagnitudeWeight(t *testing.T) {
+	etf := NewETF()
+
+	for d := float32(-1.5); d <= 1.5; d += 0.001 {
+		expected := etf.computeWeightMagnitude(d, 0)
+		if w := magnitudeWeight(d); math.Abs(float64(w-expected)) > 1e-6 {
+			t.Fatalf("expected magnitude weight %v for difference %v, got %v", expected, d, w)
+		}
+	}
+}
+
+func TestEtf_RefineEtf(t *testing.T) {
+	newEtf := func() *Etf {
+		etf := NewETF()
+		etf.Init(64, 64)
+		if err := etf.InitDefaultEtf(fixture("circle"), imageSize); err != nil {
+			t.Fatal(err)
+		}
+		return etf
+	}
+	expected, got := newEtf(), newEtf()
+	refineReference(expected, 3)
+	got.RefineEtf(3)
+
+	for y := 0; y < imageSize.Y; y++ {
+		for x := 0; x < imageSize.X; x++ {
+			e, g := expected.flowField.GetVecfAt(y, x), got.flowField.GetVecfAt(y, x)
+			for i := range e {
+				if math.Abs(float64(e[i]-g[i])) > 1e-4 {
+					t.Fatalf("expected refined vector %v at (%d, %d), got %v", e, x, y, g)
+				}
+			}
+		}
+	}
+}
+
+func TestEtf_RefineEtfSeparable(t *testing.T) {
+	// The separable refinement approximates the circular kernel: along the straight edges of the stripes
+	// the flow is nearly the same, while along the curved edges of the circle it deviates more.
+	tests := []struct {
+		fixture string
+		maxMean float64
+	}{
+		{"stripes", 5},
+		{"circle", 10},
+	}
+
+	for _, tt := range tests {
+		newEtf := func(separable bool) *Etf {
+			etf := NewETF()
+			etf.Init(64, 64)
+			etf.SetGradientOperator(GradientSobel)
+			etf.SetSeparable(separable)
+			if err := etf.InitDefaultEtf(fixture(tt.fixture), imageSize); err != nil {
+				t.Fatal(err)
+			}
+			etf.RefineEtf(3)
+			return etf
+		}
+		circular, separable := newEtf(false), newEtf(true)
+
+		// Compare the flow directions along the edges, the flat regions having no meaningful direction.
+		var sum float64
+		var n int
+		for y := 0; y < imageSize.Y; y++ {
+			for x := 0; x < imageSize.X; x++ {
+				if circular.magnitudeAt(x, y) < 0.1 {
+					continue
+				}
+				c, s := circular.flowField.GetVecfAt(y, x), separable.flowField.GetVecfAt(y, x)
+				dot := math.Min(math.Abs(float64(c[0]*s[0]+c[1]*s[1]+c[2]*s[2])), 1)
+				sum += math.Acos(dot) * 180 / math.Pi
+				n++
+			}
+		}
+		if n == 0 {
+			t.Fatalf("%s: expected edge pixels in the fixture", tt.fixture)
+		}
+		if mean := sum / float64(n); mean > tt.maxMean {
+			t.Errorf("%s: expected the separable flow to deviate less than %v degrees on average, got %.2f", tt.fixture, tt.maxMean, mean)
+		}
+	}
+}
+
+func TestEtf_RotateFlow(t *testing.T) {
+	etf := newUniformEtf(4, gocv.Vecf{1, 0, 0}, 1)
+	etf.gradientField.SetTo(gocv.NewScalar(1, 0, 0, 0))
+	etf.rotateFlow(&etf.gradientField, &etf.flowField, 90)
+
+	v := etf.flowField.GetVecfAt(1, 1)
+	if math.Abs(float64(v[0])) > 1e-6 || math.Abs(float64(v[1])-1) > 1e-6 {
+		t.Errorf("expected the rotated vector to be (0, 1), got %v", v)
+	}
+}
+
+func BenchmarkEtf_InitDefaultEtf(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		etf := NewETF()
+		etf.Init(64, 64)
+		if err := etf.InitDefaultEtf(fixture("circle"), imageSize); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// refineReference refines the flow field pixel by pixel with computeNewVector, the reference implementation.
+func refineReference(etf *Etf, kernel int) {
+	for y := 0; y < etf.flowField.Rows(); y++ {
+		for x := 0; x < etf.flowField.Cols(); x++ {
+			etf.computeNewVector(x, y, kernel)
+		}
+	}
+	etf.refinedEtf.CopyTo(&etf.flowField)
+}
+
+func BenchmarkEtf_RefineEtf(b *testing.B) {
+	etf := NewETF()
+	etf.Init(64, 64)
+	if err := etf.InitDefaultEtf(fixture("circle"), imageSize); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		etf.RefineEtf(3)
+	}
+}
+
+func BenchmarkEtf_RefineEtfSeparable(b *testing.B) {
+	etf := NewETF()
+	etf.Init(64, 64)
+	if err := etf.InitDefaultEtf(fixture("circle"), imageSize); err != nil {
+		b.Fatal(err)
+	}
+	etf.SetSeparable(true)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		etf.RefineEtf(3)
+	}
+}
+
+func BenchmarkEtf_RefineEtfReference(b *testing.B) {
+	etf := NewETF()
+	etf.Init(64, 64)
+	if err := etf.InitDefaultEtf(fixture("circle"), imageSize); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		refineReference(etf, 3)
+	}
+}
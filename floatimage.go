@@ -0,0 +1,25 @@
+package colidr
+
+// FloatImage is a single channel floating point image. The values are stored in row-major order.
+type FloatImage struct {
+	Width  int
+	Height int
+	Pix    []float32
+}
+
+// FDoG returns a copy of the raw flow-based difference of Gaussians response, before the thresholding.
+// The values are normalized into the [0, 1] range.
+func (c *Cld) FDoG() (*FloatImage, error) {
+	data, err := c.fDog.DataPtrFloat32()
+	if err != nil {
+		return nil, err
+	}
+	pix := make([]float32, len(data))
+	copy(pix, data)
+
+	return &FloatImage{
+		Width:  c.fDog.Cols(),
+		Height: c.fDog.Rows(),
+		Pix:    pix,
+	}, nil
+}
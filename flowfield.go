@@ -0,0 +1,200 @@
+package colidr
+
+import (
+	"fmt"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// FlowField is a dense vector field exposing the edge tangent flow (or the gradient) directions
+// together with the normalized gradient magnitude. The values are stored in row-major order.
+type FlowField struct {
+	Width  int
+	Height int
+	DX     []float32
+	DY     []float32
+	Mag    []float32
+}
+
+// NewFlowField creates an empty flow field of the provided size.
+func NewFlowField(width, height int) *FlowField {
+	return &FlowField{
+		Width:  width,
+		Height: height,
+		DX:     make([]float32, width*height),
+		DY:     make([]float32, width*height),
+		Mag:    make([]float32, width*height),
+	}
+}
+
+// NewFlowFieldFromSlices creates a flow field from the direction components and magnitude slices.
+// The magnitude slice is optional.
+func NewFlowFieldFromSlices(width, height int, dx, dy, mag []float32) (*FlowField, error) {
+	size := width * height
+	if len(dx) != size || len(dy) != size {
+		return nil, fmt.Errorf("the direction slices should have %d elements", size)
+	}
+	if mag == nil {
+		mag = make([]float32, size)
+	}
+	if len(mag) != size {
+		return nil, fmt.Errorf("the magnitude slice should have %d elements", size)
+	}
+	return &FlowField{Width: width, Height: height, DX: dx, DY: dy, Mag: mag}, nil
+}
+
+// NewFlowFieldFromMat creates a flow field from a 3 channel float matrix using the Etf layout,
+// where the first channel holds the vertical and the second channel the horizontal component.
+// The magnitude matrix is optional and can have one or three channels, in which case they are averaged.
+func NewFlowFieldFromMat(flow gocv.Mat, mag *gocv.Mat) (*FlowField, error) {
+	if flow.Type() != gocv.MatTypeCV32F+gocv.MatChannels3 {
+		return nil, fmt.Errorf("the flow matrix should be of CV32FC3 type")
+	}
+	ff := NewFlowField(flow.Cols(), flow.Rows())
+
+	data, err := flow.DataPtrFloat32()
+	if err != nil {
+		return nil, err
+	}
+	for i := range ff.DX {
+		ff.DY[i] = data[i*3]
+		ff.DX[i] = data[i*3+1]
+	}
+
+	if mag != nil {
+		if mag.Rows() != flow.Rows() || mag.Cols() != flow.Cols() {
+			return nil, fmt.Errorf("the magnitude and flow matrices should have the same size")
+		}
+		values, err := mag.DataPtrFloat32()
+		if err != nil {
+			return nil, err
+		}
+		ch := mag.Channels()
+		for i := range ff.Mag {
+			var sum float32
+			for c := 0; c < ch; c++ {
+				sum += values[i*ch+c]
+			}
+			ff.Mag[i] = sum / float32(ch)
+		}
+	}
+	return ff, nil
+}
+
+// At returns the direction at the (x, y) position.
+func (ff *FlowField) At(x, y int) (dx, dy float32) {
+	idx := y*ff.Width + x
+	return ff.DX[idx], ff.DY[idx]
+}
+
+// Magnitude returns the gradient magnitude at the (x, y) position.
+func (ff *FlowField) Magnitude(x, y int) float32 {
+	return ff.Mag[y*ff.Width+x]
+}
+
+// Sample returns the bilinearly interpolated direction at the (x, y) position.
+// Because the flow directions are sign ambiguous, the neighbouring vectors are aligned
+// to the nearest one before the interpolation and the result is normalized.
+// The coordinates are clamped to the field bounds.
+func (ff *FlowField) Sample(x, y float64) (dx, dy float32) {
+	x0, y0, x1, y1, fx, fy := ff.cell(x, y)
+
+	// The reference vector is the one of the nearest cell corner.
+	cx, cy := x0, y0
+	if fx >= 0.5 {
+		cx = x1
+	}
+	if fy >= 0.5 {
+		cy = y1
+	}
+	rx, ry := ff.At(cx, cy)
+	var sx, sy float64
+	for _, n := range []struct {
+		x, y int
+		w    float64
+	}{
+		{x0, y0, (1 - fx) * (1 - fy)},
+		{x1, y0, fx * (1 - fy)},
+		{x0, y1, (1 - fx) * fy},
+		{x1, y1, fx * fy},
+	} {
+		vx, vy := ff.At(n.x, n.y)
+		if vx*rx+vy*ry < 0 {
+			vx, vy = -vx, -vy
+		}
+		sx += float64(vx) * n.w
+		sy += float64(vy) * n.w
+	}
+
+	norm := math.Sqrt(sx*sx + sy*sy)
+	if norm == 0 {
+		return 0, 0
+	}
+	return float32(sx / norm), float32(sy / norm)
+}
+
+// SampleMagnitude returns the bilinearly interpolated gradient magnitude at the (x, y) position.
+func (ff *FlowField) SampleMagnitude(x, y float64) float32 {
+	x0, y0, x1, y1, fx, fy := ff.cell(x, y)
+
+	m := float64(ff.Magnitude(x0, y0))*(1-fx)*(1-fy) +
+		float64(ff.Magnitude(x1, y0))*fx*(1-fy) +
+		float64(ff.Magnitude(x0, y1))*(1-fx)*fy +
+		float64(ff.Magnitude(x1, y1))*fx*fy
+	return float32(m)
+}
+
+// cell returns the corners of the grid cell containing the (x, y) position and the fractional offsets.
+func (ff *FlowField) cell(x, y float64) (x0, y0, x1, y1 int, fx, fy float64) {
+	x = math.Min(math.Max(x, 0), float64(ff.Width-1))
+	y = math.Min(math.Max(y, 0), float64(ff.Height-1))
+
+	x0, y0 = int(x), int(y)
+	x1 = clampInt(x0+1, 0, ff.Width-1)
+	y1 = clampInt(y0+1, 0, ff.Height-1)
+
+	return x0, y0, x1, y1, x - float64(x0), y - float64(y0)
+}
+
+// ToMat converts the flow directions to a 3 channel float matrix using the Etf layout.
+func (ff *FlowField) ToMat() gocv.Mat {
+	m := gocv.NewMatWithSize(ff.Height, ff.Width, gocv.MatTypeCV32F+gocv.MatChannels3)
+	data, _ := m.DataPtrFloat32()
+
+	for i := range ff.DX {
+		data[i*3] = ff.DY[i]
+		data[i*3+1] = ff.DX[i]
+		data[i*3+2] = 0
+	}
+	return m
+}
+
+// MagnitudeMat converts the gradient magnitude to a single channel float matrix.
+func (ff *FlowField) MagnitudeMat() gocv.Mat {
+	m := gocv.NewMatWithSize(ff.Height, ff.Width, gocv.MatTypeCV32F)
+	data, _ := m.DataPtrFloat32()
+	copy(data, ff.Mag)
+
+	return m
+}
+
+// FlowField returns a copy of the edge tangent flow.
+func (etf *Etf) FlowField() (*FlowField, error) {
+	return NewFlowFieldFromMat(etf.flowField, &etf.gradientMag)
+}
+
+// GradientFlow returns a copy of the gradient field, holding the gradient vectors instead of the tangents.
+func (etf *Etf) GradientFlow() (*FlowField, error) {
+	return NewFlowFieldFromMat(etf.gradientField, &etf.gradientMag)
+}
+
+// FlowField returns a copy of the edge tangent flow used by the line drawing.
+func (c *Cld) FlowField() (*FlowField, error) {
+	return c.etf.FlowField()
+}
+
+// GradientFlow returns a copy of the gradient field used by the line drawing.
+func (c *Cld) GradientFlow() (*FlowField, error) {
+	return c.etf.GradientFlow()
+}
@@ -0,0 +1,78 @@
+package colidr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFlowField_FromSlices(t *testing.T) {
+	if _, err := NewFlowFieldFromSlices(2, 2, make([]float32, 3), make([]float32, 4), nil); err == nil {
+		t.Error("expected an error for a wrongly sized direction slice")
+	}
+	if _, err := NewFlowFieldFromSlices(2, 2, make([]float32, 4), make([]float32, 4), make([]float32, 2)); err == nil {
+		t.Error("expected an error for a wrongly sized magnitude slice")
+	}
+
+	ff, err := NewFlowFieldFromSlices(2, 1, []float32{1, 0}, []float32{0, 1}, []float32{0.2, 0.4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dx, dy := ff.At(1, 0); dx != 0 || dy != 1 {
+		t.Errorf("expected direction (0, 1), got (%v, %v)", dx, dy)
+	}
+	if m := ff.Magnitude(1, 0); m != 0.4 {
+		t.Errorf("expected magnitude 0.4, got %v", m)
+	}
+}
+
+func TestFlowField_Sample(t *testing.T) {
+	// The opposite vectors describe the same orientation and should not cancel out.
+	ff, err := NewFlowFieldFromSlices(2, 1, []float32{1, -1}, []float32{0, 0}, []float32{0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dx, dy := ff.Sample(0.5, 0)
+	if math.Abs(math.Abs(float64(dx))-1) > 1e-6 || dy != 0 {
+		t.Errorf("expected a unit horizontal direction, got (%v, %v)", dx, dy)
+	}
+	if m := ff.SampleMagnitude(0.25, 0); math.Abs(float64(m)-0.25) > 1e-6 {
+		t.Errorf("expected the interpolated magnitude 0.25, got %v", m)
+	}
+	// Out of bounds coordinates are clamped.
+	if m := ff.SampleMagnitude(10, -3); m != 1 {
+		t.Errorf("expected the clamped magnitude 1, got %v", m)
+	}
+	for _, p := range [][2]float64{{-1, 0}, {5, 0}, {0.5, -2}, {1, 3}} {
+		if dx, dy := ff.Sample(p[0], p[1]); math.Abs(math.Abs(float64(dx))-1) > 1e-6 || dy != 0 {
+			t.Errorf("expected a unit horizontal direction at the clamped position %v, got (%v, %v)", p, dx, dy)
+		}
+	}
+}
+
+func TestFlowField_MatConversion(t *testing.T) {
+	ff, err := NewFlowFieldFromSlices(3, 2,
+		[]float32{1, 0, 0.6, -1, 0, 0.8},
+		[]float32{0, 1, 0.8, 0, -1, 0.6},
+		[]float32{0.1, 0.2, 0.3, 0.4, 0.5, 0.6},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow, mag := ff.ToMat(), ff.MagnitudeMat()
+	defer flow.Close()
+	defer mag.Close()
+
+	if v := flow.GetVecfAt(0, 2); v[0] != 0.8 || v[1] != 0.6 {
+		t.Errorf("expected the Etf layout (0.8, 0.6), got %v", v)
+	}
+
+	res, err := NewFlowFieldFromMat(flow, &mag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ff.DX {
+		if res.DX[i] != ff.DX[i] || res.DY[i] != ff.DY[i] || res.Mag[i] != ff.Mag[i] {
+			t.Fatalf("expected identical flow fields after the conversion at index %d", i)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package colidr
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// The supported edge tangent flow visualization modes.
+const (
+	// VizLIC renders the flow using line integral convolution.
+	VizLIC = "lic"
+	// VizHSV encodes the flow direction as hue and the gradient magnitude as value.
+	VizHSV = "hsv"
+	// VizArrows draws sparse arrow glyphs over the source image.
+	VizArrows = "arrows"
+	// VizStreamlines draws evenly spaced streamlines.
+	VizStreamlines = "streamlines"
+)
+
+// defaultVizSpacing is the default distance between the arrow glyphs and the streamlines.
+const defaultVizSpacing = 16
+
+// FlowViz holds an edge tangent flow visualization, composed of a raster background and vector lines.
+type FlowViz struct {
+	Width      int
+	Height     int
+	Background image.Image
+	Lines      []Polyline
+	Stroke     color.Color
+}
+
+// Image returns the rasterized visualization.
+func (fv *FlowViz) Image() *image.NRGBA {
+	return renderPolylines(fv.Width, fv.Height, fv.Background, fv.Lines, fv.Stroke)
+}
+
+// EncodePNG writes the rasterized visualization in PNG format.
+func (fv *FlowViz) EncodePNG(w io.Writer) error {
+	return png.Encode(w, fv.Image())
+}
+
+// EncodeSVG writes the visualization in SVG format, embedding the raster background if there is one.
+func (fv *FlowViz) EncodeSVG(w io.Writer) error {
+	return encodeSVG(w, fv.Width, fv.Height, fv.Background, fv.Lines, fv.Stroke, 1.0)
+}
+
+// VisualizeFlow renders the edge tangent flow using the requested visualization mode.
+func (c *Cld) VisualizeFlow(mode string, opts VizOptions) (*FlowViz, error) {
+	if opts.Spacing <= 0 {
+		opts.Spacing = defaultVizSpacing
+	}
+	width, height := c.Image.Cols(), c.Image.Rows()
+	fv := &FlowViz{
+		Width:  width,
+		Height: height,
+		Stroke: color.NRGBA{R: 255, A: 255},
+	}
+
+	switch mode {
+	case VizLIC:
+		preview := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), height, width, gocv.MatTypeCV32F)
+		defer preview.Close()
+
+		pp := NewPostProcessing(c.BlurSize)
+		if err := pp.VizEtf(&c.etf.flowField, &preview, opts); err != nil {
+			return nil, err
+		}
+
+		gocv.Normalize(preview, &preview, 0.0, 255.0, gocv.NormMinMax)
+		preview.ConvertTo(&preview, gocv.MatTypeCV8UC1, 1.0)
+		img, err := preview.ToImage()
+		if err != nil {
+			return nil, err
+		}
+		fv.Background = img
+	case VizHSV:
+		fv.Background = c.etf.hsvImage()
+	case VizArrows:
+		img, err := c.source.ToImage()
+		if err != nil {
+			return nil, err
+		}
+		fv.Background = img
+		fv.Lines = c.etf.arrows(opts.Spacing)
+	case VizStreamlines:
+		fv.Stroke = color.Black
+		fv.Lines = c.etf.streamlines(opts.Spacing, 0)
+	default:
+		return nil, fmt.Errorf("unsupported flow visualization mode: %s", mode)
+	}
+	return fv, nil
+}
+
+// directionAt returns the normalized flow (tangent) direction at the (x, y) position.
+func (etf *Etf) directionAt(x, y int) (float64, float64) {
+	v := etf.flowField.GetVecfAt(y, x)
+	return float64(v[1]), float64(v[0])
+}
+
+// hsvImage encodes the flow orientation as hue and the gradient magnitude as value.
+// Since the flow direction has no sign, the doubled angle is used, mapping the opposite directions to the same hue.
+func (etf *Etf) hsvImage() *image.NRGBA {
+	width, height := etf.flowField.Cols(), etf.flowField.Rows()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dx, dy := etf.directionAt(x, y)
+			hue := math.Mod(2*math.Atan2(dy, dx)*180/math.Pi+720, 360)
+			val := math.Min(math.Max(float64(etf.magnitudeAt(x, y)), 0), 1)
+			dst.SetNRGBA(x, y, hsvToRGB(hue, 1.0, val))
+		}
+	}
+	return dst
+}
+
+// arrows returns the arrow glyphs placed on a regular grid, oriented along the flow.
+func (etf *Etf) arrows(spacing int) []Polyline {
+	var lines []Polyline
+
+	width, height := etf.flowField.Cols(), etf.flowField.Rows()
+	length := float64(spacing) * 0.8
+	head := length * 0.3
+
+	for y := spacing / 2; y < height; y += spacing {
+		for x := spacing / 2; x < width; x += spacing {
+			dx, dy := etf.directionAt(x, y)
+			if dx == 0 && dy == 0 {
+				continue
+			}
+			tail := Point{float64(x) - dx*length/2, float64(y) - dy*length/2}
+			tip := Point{float64(x) + dx*length/2, float64(y) + dy*length/2}
+
+			// The arrow head wings are rotated by ±150° from the arrow direction.
+			angle := math.Atan2(dy, dx)
+			left := Point{tip.X + head*math.Cos(angle+5*math.Pi/6), tip.Y + head*math.Sin(angle+5*math.Pi/6)}
+			right := Point{tip.X + head*math.Cos(angle-5*math.Pi/6), tip.Y + head*math.Sin(angle-5*math.Pi/6)}
+
+			lines = append(lines, Polyline{tail, tip}, Polyline{left, tip, right})
+		}
+	}
+	return lines
+}
+
+// streamlines traces evenly spaced streamlines following the flow.
+func (etf *Etf) streamlines(spacing, maxLength int) []Polyline {
+	width, height := etf.flowField.Cols(), etf.flowField.Rows()
+	return evenStreamlines(width, height, spacing, maxLength, etf.directionAt, nil)
+}
+
+// evenStreamlines traces evenly spaced streamlines along the provided direction field, following
+// a simplified version of the Jobard and Lefer algorithm: a new streamline is stopped when it gets closer
+// than half of the spacing to an existing one. If the inside function is provided,
+// the streamlines are restricted to the region where it returns true.
+func evenStreamlines(
+	width, height, spacing, maxLength int,
+	direction func(x, y int) (float64, float64),
+	inside func(x, y int) bool,
+) []Polyline {
+	var lines []Polyline
+
+	if maxLength <= 0 {
+		maxLength = width + height
+	}
+	grid := newPointGrid(width, height, float64(spacing))
+	tracer := &streamTracer{
+		width:     width,
+		height:    height,
+		maxLength: maxLength,
+		minDist:   float64(spacing) / 2,
+		grid:      grid,
+		direction: direction,
+		inside:    inside,
+	}
+
+	for y := spacing / 2; y < height; y += spacing {
+		for x := spacing / 2; x < width; x += spacing {
+			if inside != nil && !inside(x, y) {
+				continue
+			}
+			seed := Point{float64(x), float64(y)}
+			if grid.near(seed, float64(spacing)) {
+				continue
+			}
+			forward := tracer.trace(seed, 1)
+			backward := tracer.trace(seed, -1)
+
+			line := make(Polyline, 0, len(forward)+len(backward)+1)
+			for i := len(backward) - 1; i >= 0; i-- {
+				line = append(line, backward[i])
+			}
+			line = append(line, seed)
+			line = append(line, forward...)
+
+			if len(line) < 3 {
+				continue
+			}
+			for _, p := range line {
+				grid.add(p)
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// streamTracer follows a direction field starting from a seed point.
+type streamTracer struct {
+	width, height int
+	maxLength     int
+	minDist       float64
+	grid          *pointGrid
+	direction     func(x, y int) (float64, float64)
+	inside        func(x, y int) bool
+}
+
+// trace follows the direction field from the seed point in the provided direction,
+// keeping the orientation consistent between the consecutive steps.
+func (st *streamTracer) trace(seed Point, sign float64) Polyline {
+	var line Polyline
+
+	p := seed
+	px, py := 0.0, 0.0
+
+	for i := 0; i < st.maxLength; i++ {
+		dx, dy := st.direction(int(p.X), int(p.Y))
+		norm := math.Hypot(dx, dy)
+		if norm == 0 {
+			break
+		}
+		dx, dy = dx/norm, dy/norm
+
+		if i == 0 {
+			dx, dy = dx*sign, dy*sign
+		} else if dx*px+dy*py < 0 {
+			dx, dy = -dx, -dy
+		}
+		p = Point{p.X + dx, p.Y + dy}
+		if p.X < 0 || p.X > float64(st.width-1) || p.Y < 0 || p.Y > float64(st.height-1) {
+			break
+		}
+		if st.inside != nil && !st.inside(int(p.X), int(p.Y)) {
+			break
+		}
+		if st.grid.near(p, st.minDist) {
+			break
+		}
+		line = append(line, p)
+		px, py = dx, dy
+	}
+	return line
+}
+
+// pointGrid is a spatial hash used for the fast lookup of the nearby streamline points.
+type pointGrid struct {
+	cellSize   float64
+	cols, rows int
+	cells      [][]Point
+}
+
+// newPointGrid creates a new point grid with the provided cell size.
+func newPointGrid(width, height int, cellSize float64) *pointGrid {
+	cols := int(float64(width)/cellSize) + 1
+	rows := int(float64(height)/cellSize) + 1
+	return &pointGrid{
+		cellSize: cellSize,
+		cols:     cols,
+		rows:     rows,
+		cells:    make([][]Point, cols*rows),
+	}
+}
+
+// add inserts a point into the grid.
+func (g *pointGrid) add(p Point) {
+	cx, cy := int(p.X/g.cellSize), int(p.Y/g.cellSize)
+	g.cells[cy*g.cols+cx] = append(g.cells[cy*g.cols+cx], p)
+}
+
+// near reports whether there is a point closer than dist to p. The distance should not exceed the cell size.
+func (g *pointGrid) near(p Point, dist float64) bool {
+	cx, cy := int(p.X/g.cellSize), int(p.Y/g.cellSize)
+
+	for y := cy - 1; y <= cy+1; y++ {
+		for x := cx - 1; x <= cx+1; x++ {
+			if x < 0 || x >= g.cols || y < 0 || y >= g.rows {
+				continue
+			}
+			for _, q := range g.cells[y*g.cols+x] {
+				if (p.X-q.X)*(p.X-q.X)+(p.Y-q.Y)*(p.Y-q.Y) < dist*dist {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// hsvToRGB converts a HSV color (hue in degrees, saturation and value in [0, 1]) to RGB.
+func hsvToRGB(h, s, v float64) color.NRGBA {
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return color.NRGBA{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+		A: 255,
+	}
+}
@@ -0,0 +1,106 @@
+package colidr
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	"gocv.io/x/gocv"
+)
+
+// The default hatching values.
+const (
+	defaultHatchSpacing        = 6
+	defaultHatchThreshold      = 0.6
+	defaultCrossHatchThreshold = 0.3
+)
+
+// HatchOptions contains the options of the flow guided hatching.
+type HatchOptions struct {
+	// Spacing is the distance between the hatching strokes.
+	Spacing int
+	// Threshold is the tone (in the [0, 1] range) below which the regions are hatched along the flow.
+	Threshold float64
+	// CrossThreshold is the tone below which the regions are cross-hatched, perpendicular to the flow.
+	CrossThreshold float64
+	// MaxLength is the maximum length of a hatching stroke. Zero means unlimited.
+	MaxLength int
+	// Outlines combines the hatching with the coherent line drawing.
+	Outlines bool
+}
+
+// Hatching holds the hatching strokes together with the optional line drawing outlines.
+type Hatching struct {
+	Width    int
+	Height   int
+	Strokes  []Polyline
+	Outlines image.Image
+}
+
+// Image returns the rasterized hatching.
+func (h *Hatching) Image() *image.NRGBA {
+	return renderPolylines(h.Width, h.Height, h.Outlines, h.Strokes, color.Black)
+}
+
+// EncodeSVG writes the hatching strokes in SVG format. The outlines are embedded as raster image.
+func (h *Hatching) EncodeSVG(w io.Writer) error {
+	return encodeSVG(w, h.Width, h.Height, h.Outlines, h.Strokes, color.Black, 1.0)
+}
+
+// Hatch fills the dark regions of the source image with hatching strokes aligned to the edge tangent flow,
+// and the darkest regions with cross-hatching strokes perpendicular to the flow.
+// If the outlines are requested, it should be called after GenerateCld.
+func (c *Cld) Hatch(opts HatchOptions) (*Hatching, error) {
+	if opts.Spacing <= 0 {
+		opts.Spacing = defaultHatchSpacing
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = defaultHatchThreshold
+	}
+	if opts.CrossThreshold <= 0 {
+		opts.CrossThreshold = defaultCrossHatchThreshold
+	}
+	if opts.Threshold > 1 || opts.CrossThreshold > opts.Threshold {
+		return nil, fmt.Errorf("the hatching thresholds should satisfy 0 < cross threshold <= threshold <= 1")
+	}
+
+	tone := c.tone()
+	defer tone.Close()
+
+	width, height := c.Image.Cols(), c.Image.Rows()
+	h := &Hatching{Width: width, Height: height}
+
+	below := func(threshold float64) func(x, y int) bool {
+		t := uint8(threshold * 255)
+		return func(x, y int) bool {
+			return tone.GetUCharAt(y, x) < t
+		}
+	}
+	perpendicular := func(x, y int) (float64, float64) {
+		dx, dy := c.etf.directionAt(x, y)
+		return -dy, dx
+	}
+
+	h.Strokes = evenStreamlines(width, height, opts.Spacing, opts.MaxLength, c.etf.directionAt, below(opts.Threshold))
+	h.Strokes = append(h.Strokes,
+		evenStreamlines(width, height, opts.Spacing, opts.MaxLength, perpendicular, below(opts.CrossThreshold))...,
+	)
+
+	if opts.Outlines {
+		var err error
+		if h.Outlines, err = c.result.ToImage(); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// tone returns the smoothed grayscale version of the source image.
+func (c *Cld) tone() gocv.Mat {
+	src := gocv.NewMat()
+	gocv.CvtColor(c.source, &src, gocv.ColorBGRToGray)
+	gocv.GaussianBlur(src, &src, image.Point{5, 5}, 0, 0, gocv.BorderReplicate)
+
+	return src
+}
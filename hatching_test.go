@@ -0,0 +1,76 @@
+package colidr
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// hatchTest returns a Cld with a uniform source tone and a vertical flow.
+func hatchTest(tone float64) *Cld {
+	c := newTestCld(32, testOptions())
+	c.etf = newUniformEtf(32, gocv.Vecf{1, 0, 0}, 1)
+	c.source.SetTo(gocv.NewScalar(tone, tone, tone, 0))
+	return c
+}
+
+// strokeOrientation splits the strokes into vertical and horizontal ones, returning their X and Y positions.
+func strokeOrientation(t *testing.T, strokes []Polyline) (xs, ys []float64) {
+	for _, s := range strokes {
+		first, last := s[0], s[len(s)-1]
+		switch {
+		case math.Abs(first.X-last.X) < 1e-6:
+			xs = append(xs, first.X)
+		case math.Abs(first.Y-last.Y) < 1e-6:
+			ys = append(ys, first.Y)
+		default:
+			t.Fatalf("expected the strokes to follow the flow or its normal, got %v", s)
+		}
+	}
+	sort.Float64s(xs)
+	sort.Float64s(ys)
+	return xs, ys
+}
+
+func TestCld_Hatch(t *testing.T) {
+	opts := HatchOptions{Spacing: 6, Threshold: 0.6, CrossThreshold: 0.3}
+
+	// A tone between the thresholds is hatched along the flow only, with evenly spaced strokes.
+	h, err := hatchTest(128).Hatch(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xs, ys := strokeOrientation(t, h.Strokes)
+	if len(xs) != 5 || len(ys) != 0 {
+		t.Fatalf("expected 5 strokes along the flow and no cross-hatching, got %d and %d", len(xs), len(ys))
+	}
+	for i := 1; i < len(xs); i++ {
+		if d := xs[i] - xs[i-1]; d != float64(opts.Spacing) {
+			t.Errorf("expected the strokes to be spaced by %d pixels, got %v", opts.Spacing, d)
+		}
+	}
+
+	// A tone below the cross threshold is cross-hatched as well.
+	h, err = hatchTest(50).Hatch(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xs, ys := strokeOrientation(t, h.Strokes); len(xs) != 5 || len(ys) != 5 {
+		t.Errorf("expected 5 strokes along the flow and 5 cross-hatching strokes, got %d and %d", len(xs), len(ys))
+	}
+
+	// A tone above the threshold is not hatched.
+	h, err = hatchTest(220).Hatch(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Strokes) != 0 {
+		t.Errorf("expected no strokes in the light regions, got %d", len(h.Strokes))
+	}
+
+	if _, err := hatchTest(128).Hatch(HatchOptions{Threshold: 0.3, CrossThreshold: 0.6}); err == nil {
+		t.Error("expected an error for a cross threshold above the threshold")
+	}
+}
@@ -0,0 +1,55 @@
+package colidr
+
+import (
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// hysteresisThreshold applies a two level threshold on the FDoG matrix.
+// The pixels below tau are considered strong and are kept as ink, while the pixels between
+// tau and weakTau are kept only if they are connected to a strong pixel by following the flow direction.
+// This way the faint continuations of the strong lines are preserved.
+func (c *Cld) hysteresisThreshold(src, dst *gocv.Mat, tau, weakTau float32) {
+	c.binaryThreshold(src, dst, tau)
+
+	width, height := dst.Cols(), dst.Rows()
+	values, err := src.DataPtrFloat32()
+	if err != nil {
+		return
+	}
+	data := dst.DataPtrUint8()
+	flow, _ := c.etf.flowField.DataPtrFloat32()
+
+	var queue []int
+	for i, v := range data {
+		if v == 0 {
+			queue = append(queue, i)
+		}
+	}
+
+	for len(queue) > 0 {
+		idx := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+
+		x, y := idx%width, idx/width
+		direction := position{x: float64(flow[3*idx+1]), y: float64(flow[3*idx])}
+		if direction.x == 0 && direction.y == 0 {
+			continue
+		}
+
+		// Follow the flow in both directions.
+		for _, sign := range []float64{1, -1} {
+			col := int(math.Round(float64(x) + sign*direction.x))
+			row := int(math.Round(float64(y) + sign*direction.y))
+			if row < 0 || row > height-1 || col < 0 || col > width-1 {
+				continue
+			}
+			n := row*width + col
+			if data[n] != 0 && values[n] < weakTau {
+				data[n] = 0
+				queue = append(queue, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package colidr
+
+import (
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestCld_HysteresisThreshold(t *testing.T) {
+	// The uniform flow is vertical.
+	c := newTestCld(16, testOptions())
+	c.etf = newUniformEtf(16, gocv.Vecf{1, 0, 0}, 1)
+	c.fDog.SetTo(gocv.NewScalar(1, 0, 0, 0))
+
+	// A strong pixel continued by a weak segment along the flow and by another one across the flow,
+	// and an isolated weak segment.
+	c.fDog.SetFloatAt(4, 8, 0.5)
+	for i := 1; i <= 4; i++ {
+		c.fDog.SetFloatAt(4+i, 8, 0.95)
+		c.fDog.SetFloatAt(4, 8+i, 0.95)
+		c.fDog.SetFloatAt(4+i, 3, 0.95)
+	}
+	c.hysteresisThreshold(&c.fDog, &c.result, 0.9, 0.97)
+
+	for i := 1; i <= 4; i++ {
+		if v := c.result.GetUCharAt(4+i, 8); v != 0 {
+			t.Errorf("expected the weak pixel connected along the flow to be kept at (8, %d)", 4+i)
+		}
+		if v := c.result.GetUCharAt(4, 8+i); v != 255 {
+			t.Errorf("expected the weak pixel connected across the flow to be removed at (%d, 4)", 8+i)
+		}
+		if v := c.result.GetUCharAt(4+i, 3); v != 255 {
+			t.Errorf("expected the isolated weak pixel to be removed at (3, %d)", 4+i)
+		}
+	}
+	if v := c.result.GetUCharAt(4, 8); v != 0 {
+		t.Error("expected the strong pixel to be kept")
+	}
+}
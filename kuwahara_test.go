@@ -0,0 +1,105 @@
+package colidr
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestCld_Kuwahara(t *testing.T) {
+	c := newTestCld(8, testOptions())
+	c.source.SetTo(gocv.NewScalar(10, 20, 30, 0))
+	c.result.SetTo(gocv.NewScalar(255, 0, 0, 0))
+	c.result.SetUCharAt(4, 4, 0)
+
+	// A uniform source image is not modified by the filter.
+	img, err := c.Kuwahara(KuwaharaOptions{Radius: 3, Lines: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if col := img.NRGBAAt(1, 1); col != (color.NRGBA{R: 30, G: 20, B: 10, A: 255}) {
+		t.Errorf("expected the source color, got %v", col)
+	}
+	if col := img.NRGBAAt(4, 4); col != (color.NRGBA{A: 255}) {
+		t.Errorf("expected a black line pixel, got %v", col)
+	}
+
+	if _, err := c.Kuwahara(KuwaharaOptions{Sectors: 2}); err == nil {
+		t.Error("expected an error for less than 3 sectors")
+	}
+}
+
+func TestCld_KuwaharaFollowsFlow(t *testing.T) {
+	const size = 24
+
+	// kuwaharaRow filters the image having the dark columns with a uniform vertical or horizontal flow,
+	// returning the red channel of its middle row.
+	kuwaharaRow := func(dark func(x int) bool, vertical bool) []uint8 {
+		c := newTestCld(size, testOptions())
+		flow, gradient := gocv.NewScalar(1, 0, 0, 0), gocv.NewScalar(0, 1, 0, 0)
+		if !vertical {
+			flow, gradient = gradient, flow
+		}
+		c.etf.flowField.SetTo(flow)
+		c.etf.gradientField.SetTo(gradient)
+
+		data := make([]byte, 3*size*size)
+		for i := range data {
+			data[i] = 220
+			if dark((i / 3) % size) {
+				data[i] = 30
+			}
+		}
+		copy(c.source.DataPtrUint8(), data)
+
+		img, err := c.Kuwahara(KuwaharaOptions{Radius: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		row := make([]uint8, size)
+		for x := range row {
+			row[x] = img.NRGBAAt(x, size/2).R
+		}
+		return row
+	}
+
+	// A step edge along the flow stays sharp across it.
+	row := kuwaharaRow(func(x int) bool { return x < size/2 }, true)
+	if row[size/2-1] > 40 || row[size/2] < 210 {
+		t.Errorf("expected a sharp step edge across the flow, got %v", row)
+	}
+
+	// A thin line is preserved by the kernel stretched along it, but not by the one stretched across it.
+	line := func(x int) bool { return x == size/2-1 || x == size/2 }
+	if row := kuwaharaRow(line, true); row[size/2-1] > 40 || row[size/2] > 40 {
+		t.Errorf("expected the thin line along the flow to be preserved, got %v", row)
+	}
+	if row := kuwaharaRow(line, false); row[size/2-1] < 150 || row[size/2] < 150 {
+		t.Errorf("expected the thin line across the flow to be smoothed away, got %v", row)
+	}
+}
+
+func TestAnisotropy(t *testing.T) {
+	const size = 16
+	ff := NewFlowField(size, size)
+	for i := range ff.DX {
+		ff.DX[i], ff.Mag[i] = 1, 1
+	}
+	for _, a := range anisotropy(ff) {
+		if math.Abs(a-1) > 1e-6 {
+			t.Fatalf("expected anisotropy 1 for a uniform gradient, got %v", a)
+		}
+	}
+
+	// Alternating orthogonal gradients cancel each other in the smoothed structure tensor.
+	for i := range ff.DX {
+		if (i/size+i%size)%2 == 0 {
+			ff.DX[i], ff.DY[i] = 0, 1
+		}
+	}
+	if a := anisotropy(ff)[size*size/2+size/2]; a > 0.2 {
+		t.Errorf("expected a low anisotropy for orthogonal gradients, got %v", a)
+	}
+}
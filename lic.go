@@ -0,0 +1,173 @@
+package colidr
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// The supported line integral convolution kernel shapes.
+const (
+	LICBox      = "box"
+	LICTriangle = "triangle"
+	LICGaussian = "gaussian"
+)
+
+// The default line integral convolution values.
+const (
+	defaultLICLength = 10
+	defaultLICStep   = 1
+)
+
+// LICOptions contains the options of the line integral convolution.
+type LICOptions struct {
+	// Length is the number of steps the streamlines are followed in both directions. Defaults to 10.
+	Length int
+	// Step is the distance in pixels between two consecutive streamline samples. Defaults to 1.
+	Step float64
+	// Kernel is the shape of the convolution kernel along the streamline: LICBox, weighting the samples equally,
+	// LICTriangle or LICGaussian, decreasing the weights with the distance. Defaults to LICGaussian.
+	Kernel string
+	// Bilinear enables the bilinear sampling of the texture and of the flow at the streamline positions.
+	// Otherwise the nearest pixel is used.
+	Bilinear bool
+}
+
+// LIC smears the texture along the flow field using line integral convolution:
+// each pixel is the weighted average of the texture samples taken along the streamline passing through it.
+// Using a noise texture it visualizes the flow, while using an image it gives a brushed, painterly look.
+// The texture should have the same size as the flow field.
+func LIC(flow FlowField, texture image.Image, opts LICOptions) (*image.NRGBA, error) {
+	if opts.Length <= 0 {
+		opts.Length = defaultLICLength
+	}
+	if opts.Step <= 0 {
+		opts.Step = defaultLICStep
+	}
+	if opts.Kernel == "" {
+		opts.Kernel = LICGaussian
+	}
+	weights, err := licKernel(opts.Kernel, opts.Length)
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := flow.Width, flow.Height
+	if len(flow.DX) != width*height || len(flow.DY) != width*height {
+		return nil, fmt.Errorf("the flow field direction slices should have %d elements", width*height)
+	}
+	bounds := texture.Bounds()
+	if bounds.Dx() != width || bounds.Dy() != height {
+		return nil, fmt.Errorf("the texture and the flow field should have the same size")
+	}
+
+	// The premultiplied texture colors are averaged, so the transparent pixels don't bleed their color.
+	tex := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(tex, tex.Bounds(), texture, bounds.Min, draw.Src)
+
+	sample := func(x, y float64, w float64, acc *[4]float64) {
+		if !opts.Bilinear {
+			i := 4 * (int(math.Round(y))*width + int(math.Round(x)))
+			for ch := 0; ch < 4; ch++ {
+				acc[ch] += w * float64(tex.Pix[i+ch])
+			}
+			return
+		}
+		x0, y0 := int(x), int(y)
+		x1, y1 := clampInt(x0+1, 0, width-1), clampInt(y0+1, 0, height-1)
+		fx, fy := x-float64(x0), y-float64(y0)
+
+		for _, n := range []struct {
+			x, y int
+			w    float64
+		}{
+			{x0, y0, (1 - fx) * (1 - fy)},
+			{x1, y0, fx * (1 - fy)},
+			{x0, y1, (1 - fx) * fy},
+			{x1, y1, fx * fy},
+		} {
+			i := 4 * (n.y*width + n.x)
+			for ch := 0; ch < 4; ch++ {
+				acc[ch] += w * n.w * float64(tex.Pix[i+ch])
+			}
+		}
+	}
+	direction := func(x, y float64) (float32, float32) {
+		if opts.Bilinear {
+			return flow.Sample(x, y)
+		}
+		dx, dy := flow.At(int(math.Round(x)), int(math.Round(y)))
+		norm := float32(math.Hypot(float64(dx), float64(dy)))
+		if norm == 0 {
+			return 0, 0
+		}
+		return dx / norm, dy / norm
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	parallelRows(height, func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := 0; x < width; x++ {
+				var acc [4]float64
+				sample(float64(x), float64(y), weights[0], &acc)
+				wSum := weights[0]
+
+				// Follow the streamline in both directions, keeping the direction consistent between the steps.
+				tx, ty := direction(float64(x), float64(y))
+				for _, sign := range []float32{1, -1} {
+					px, py := float64(x), float64(y)
+					prevX, prevY := sign*tx, sign*ty
+					for k := 1; k <= opts.Length; k++ {
+						dx, dy := direction(px, py)
+						if dx*prevX+dy*prevY < 0 {
+							dx, dy = -dx, -dy
+						}
+						if dx == 0 && dy == 0 {
+							break
+						}
+						px, py = px+opts.Step*float64(dx), py+opts.Step*float64(dy)
+						if px < 0 || px > float64(width-1) || py < 0 || py > float64(height-1) {
+							break
+						}
+						sample(px, py, weights[k], &acc)
+						wSum += weights[k]
+						prevX, prevY = dx, dy
+					}
+				}
+
+				c := color.NRGBAModel.Convert(color.RGBA{
+					R: uint8(math.Round(acc[0] / wSum)),
+					G: uint8(math.Round(acc[1] / wSum)),
+					B: uint8(math.Round(acc[2] / wSum)),
+					A: uint8(math.Round(acc[3] / wSum)),
+				}).(color.NRGBA)
+				dst.SetNRGBA(x, y, c)
+			}
+		}
+	})
+	return dst, nil
+}
+
+// licKernel returns the weights of the convolution kernel for the 0...length distances along the streamline.
+func licKernel(shape string, length int) ([]float64, error) {
+	weights := make([]float64, length+1)
+	sigma := float64(length) / 2
+
+	for k := range weights {
+		d := float64(k)
+		switch shape {
+		case LICBox:
+			weights[k] = 1
+		case LICTriangle:
+			weights[k] = 1 - d/float64(length+1)
+		case LICGaussian:
+			weights[k] = math.Exp(-d * d / (2 * sigma * sigma))
+		default:
+			return nil, fmt.Errorf("unsupported LIC kernel: %s", shape)
+		}
+	}
+	return weights, nil
+}
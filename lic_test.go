@@ -0,0 +1,79 @@
+package colidr
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// stripes returns a gray texture having alternating black and white rows or columns.
+func stripes(size int, vertical bool) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if (vertical && x%2 == 0) || (!vertical && y%2 == 0) {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestLIC(t *testing.T) {
+	const size = 16
+	ff := NewFlowField(size, size)
+	for i := range ff.DX {
+		ff.DX[i] = 1
+	}
+
+	for _, bilinear := range []bool{false, true} {
+		// The texture is preserved along the flow and smeared across the flow.
+		img, err := LIC(*ff, stripes(size, false), LICOptions{Length: 4, Kernel: LICBox, Bilinear: bilinear})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := img.NRGBAAt(8, 8); c != (color.NRGBA{R: 255, G: 255, B: 255, A: 255}) {
+			t.Errorf("expected the stripes along the flow to be preserved, got %v", c)
+		}
+		img, err = LIC(*ff, stripes(size, true), LICOptions{Length: 4, Kernel: LICBox, Bilinear: bilinear})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := img.NRGBAAt(8, 8); c.R < 100 || c.R > 160 {
+			t.Errorf("expected the stripes across the flow to be averaged, got %v", c)
+		}
+	}
+
+	uniform := image.NewUniform(color.NRGBA{R: 10, G: 20, B: 30, A: 255})
+	img, err := LIC(*ff, image.NewRGBA(image.Rect(0, 0, size, size)), LICOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := img.NRGBAAt(4, 4); c.A != 0 {
+		t.Errorf("expected a transparent pixel, got %v", c)
+	}
+	if _, err := LIC(*ff, uniform, LICOptions{}); err == nil {
+		t.Error("expected an error for the texture size not matching the flow field")
+	}
+	if _, err := LIC(*ff, stripes(size, true), LICOptions{Kernel: "disc"}); err == nil {
+		t.Error("expected an error for the unsupported kernel")
+	}
+}
+
+func TestLICKernel(t *testing.T) {
+	for _, shape := range []string{LICBox, LICTriangle, LICGaussian} {
+		weights, err := licKernel(shape, 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if weights[0] != 1 {
+			t.Errorf("expected the %s kernel to be 1 at the center, got %v", shape, weights[0])
+		}
+		for k := 1; k < len(weights); k++ {
+			if weights[k] > weights[k-1] || weights[k] <= 0 {
+				t.Errorf("expected positive, non-increasing %s kernel weights, got %v", shape, weights)
+				break
+			}
+		}
+	}
+}
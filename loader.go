@@ -0,0 +1,202 @@
+package colidr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+
+	"gocv.io/x/gocv"
+
+	// Register the supported input formats.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// exifOrientationTag is the EXIF tag holding the image orientation.
+const exifOrientationTag = 0x0112
+
+// LoadImage decodes a JPEG, PNG, GIF, BMP, TIFF or WebP image, applies the EXIF orientation
+// and composites the transparent pixels over the background color. If the background is nil, white is used.
+func LoadImage(file string, background color.Color) (*image.NRGBA, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode the image %s: %v", file, err)
+	}
+	return orient(flatten(img, background), exifOrientation(data, format)), nil
+}
+
+// loadGrayMat loads a grayscale image, like a mask or a parameter map, through LoadImage so that
+// its EXIF orientation is applied. The transparent pixels are composited over black.
+func loadGrayMat(file string) (gocv.Mat, error) {
+	img, err := LoadImage(file, color.Black)
+	if err != nil {
+		return gocv.Mat{}, err
+	}
+	src := imageToMat(img)
+	defer src.Close()
+
+	gray := gocv.NewMat()
+	gocv.CvtColor(src, &gray, gocv.ColorBGRToGray)
+	return gray, nil
+}
+
+// imageToMat converts the image to a BGR matrix. Unlike gocv.ImageToMatRGB, which wraps a Go slice
+// the matrix may outlive, the pixels are copied into the memory allocated by the matrix itself.
+func imageToMat(img image.Image) gocv.Mat {
+	bounds := img.Bounds()
+	m := gocv.NewMatWithSize(bounds.Dy(), bounds.Dx(), gocv.MatTypeCV8UC3)
+	data := m.DataPtrUint8()
+
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			data[i], data[i+1], data[i+2] = byte(b>>8), byte(g>>8), byte(r>>8)
+			i += 3
+		}
+	}
+	return m
+}
+
+// flatten composites the image over the opaque background.
+func flatten(img image.Image, background color.Color) *image.NRGBA {
+	bg := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	if background != nil {
+		bg = color.NRGBAModel.Convert(background).(color.NRGBA)
+		bg.A = 255
+	}
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.ZP, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+
+	return dst
+}
+
+// orient transforms the image according to the EXIF orientation, so that it's displayed upright.
+func orient(src *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	// The orientations from 5 to 8 transpose the image.
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // flip horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotate 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // flip vertically
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90 clockwise
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 90 counter-clockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// exifOrientation returns the EXIF orientation (between 1 and 8) of the JPEG, TIFF or WebP image data.
+// It returns 1, meaning no transformation, if the orientation is not found.
+func exifOrientation(data []byte, format string) int {
+	var exif []byte
+
+	switch format {
+	case "jpeg":
+		// Look for the APP1 segment, which holds the EXIF data.
+		for i := 2; i+4 <= len(data) && data[i] == 0xff; {
+			marker := data[i+1]
+			length := int(binary.BigEndian.Uint16(data[i+2:]))
+			if marker == 0xda || i+2+length > len(data) {
+				break
+			}
+			segment := data[i+4 : i+2+length]
+			if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+				exif = segment[6:]
+				break
+			}
+			i += 2 + length
+		}
+	case "tiff":
+		exif = data
+	case "webp":
+		// Look for the EXIF chunk after the RIFF header.
+		for i := 12; i+8 <= len(data); {
+			size := int(binary.LittleEndian.Uint32(data[i+4:]))
+			if i+8+size > len(data) {
+				break
+			}
+			if string(data[i:i+4]) == "EXIF" {
+				exif = bytes.TrimPrefix(data[i+8:i+8+size], []byte("Exif\x00\x00"))
+				break
+			}
+			i += 8 + size + size%2
+		}
+	}
+	if o := tiffOrientation(exif); o >= 1 && o <= 8 {
+		return o
+	}
+	return 1
+}
+
+// tiffOrientation returns the orientation tag value of the first IFD of the TIFF structured data, or 0 if it's missing.
+func tiffOrientation(data []byte) int {
+	if len(data) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return 0
+	}
+	offset := int(order.Uint32(data[4:]))
+	if offset+2 > len(data) {
+		return 0
+	}
+	entries := int(order.Uint16(data[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + 12*i
+		if entry+12 > len(data) {
+			return 0
+		}
+		if order.Uint16(data[entry:]) == exifOrientationTag {
+			return int(order.Uint16(data[entry+8:]))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,222 @@
+package colidr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTemp encodes the image into a temporary file having the provided extension.
+func writeTemp(t *testing.T, ext string, img image.Image, encode func(io.Writer, image.Image) error) string {
+	dir, err := ioutil.TempDir("", "colidr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "image"+ext)
+
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// countDiffPixels returns the number of different pixels of the images having the same bounds.
+func countDiffPixels(a, b image.Image) int {
+	var diff int
+	for y := a.Bounds().Min.Y; y < a.Bounds().Max.Y; y++ {
+		for x := a.Bounds().Min.X; x < a.Bounds().Max.X; x++ {
+			if color.NRGBAModel.Convert(a.At(x, y)) != color.NRGBAModel.Convert(b.At(x, y)) {
+				diff++
+			}
+		}
+	}
+	return diff
+}
+
+func TestLoadImage(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 33, 17))
+	for y := 0; y < 17; y++ {
+		for x := 0; x < 33; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 7), G: uint8(y * 15), B: uint8(x * y), A: 255})
+		}
+	}
+	bilevel := image.NewGray(image.Rect(0, 0, 19, 5))
+	for i := range bilevel.Pix {
+		if i%3 == 0 {
+			bilevel.Pix[i] = 255
+		}
+	}
+
+	tests := []struct {
+		ext    string
+		img    image.Image
+		encode func(io.Writer, image.Image) error
+	}{
+		{".png", src, png.Encode},
+		{".webp", src, EncodeWebP},
+		{".tif", src, func(w io.Writer, img image.Image) error { return EncodeTIFF(w, img, nil) }},
+		{".tif", bilevel, func(w io.Writer, img image.Image) error { return EncodeTIFF(w, img, nil) }},
+		{".tif", bilevel, func(w io.Writer, img image.Image) error {
+			return EncodeTIFF(w, img, &TIFFOptions{Compression: TIFFUncompressed})
+		}},
+	}
+	for _, tt := range tests {
+		file := writeTemp(t, tt.ext, tt.img, tt.encode)
+		defer os.RemoveAll(filepath.Dir(file))
+
+		img, err := LoadImage(file, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.ext, err)
+		}
+		if img.Bounds() != tt.img.Bounds() {
+			t.Fatalf("%s: expected bounds %v, got %v", tt.ext, tt.img.Bounds(), img.Bounds())
+		}
+		if d := countDiffPixels(tt.img, img); d != 0 {
+			t.Errorf("%s: expected the decoded image to match the source, got %d different pixels", tt.ext, d)
+		}
+	}
+}
+
+func TestLoadImage_Alpha(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{A: 0})
+	src.SetNRGBA(1, 0, color.NRGBA{R: 255, A: 128})
+
+	file := writeTemp(t, ".png", src, png.Encode)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	img, err := LoadImage(file, color.NRGBA{B: 255, A: 255})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := img.NRGBAAt(0, 0); c != (color.NRGBA{B: 255, A: 255}) {
+		t.Errorf("expected the transparent pixel to be replaced by the background, got %v", c)
+	}
+	if c := img.NRGBAAt(1, 0); c.A != 255 || c.R < 127 || c.R > 129 || c.B < 126 || c.B > 128 {
+		t.Errorf("expected the semi-transparent pixel to be blended with the background, got %v", c)
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	// Minimal big endian TIFF structure holding the orientation tag.
+	exif := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], exifOrientationTag)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], 6)
+	exif = append(exif, entry...)
+
+	app1 := append([]byte("Exif\x00\x00"), exif...)
+	jpeg := []byte{0xff, 0xd8, 0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(jpeg[4:], uint16(len(app1)+2))
+	jpeg = append(jpeg, app1...)
+	jpeg = append(jpeg, 0xff, 0xda)
+
+	if o := exifOrientation(jpeg, "jpeg"); o != 6 {
+		t.Errorf("expected JPEG orientation 6, got %d", o)
+	}
+	if o := exifOrientation(exif, "tiff"); o != 6 {
+		t.Errorf("expected TIFF orientation 6, got %d", o)
+	}
+	if o := exifOrientation(jpeg[:10], "jpeg"); o != 1 {
+		t.Errorf("expected the default orientation for truncated data, got %d", o)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// 3x2 image, each pixel holding its index in the red channel.
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i := 0; i < 6; i++ {
+		src.Pix[i*4] = uint8(i)
+	}
+
+	tests := []struct {
+		orientation int
+		width       int
+		expected    []uint8
+	}{
+		{1, 3, []uint8{0, 1, 2, 3, 4, 5}},
+		{2, 3, []uint8{2, 1, 0, 5, 4, 3}},
+		{3, 3, []uint8{5, 4, 3, 2, 1, 0}},
+		{4, 3, []uint8{3, 4, 5, 0, 1, 2}},
+		{5, 2, []uint8{0, 3, 1, 4, 2, 5}},
+		{6, 2, []uint8{3, 0, 4, 1, 5, 2}},
+		{7, 2, []uint8{5, 2, 4, 1, 3, 0}},
+		{8, 2, []uint8{2, 5, 1, 4, 0, 3}},
+	}
+	for _, tt := range tests {
+		dst := orient(src, tt.orientation)
+		if dst.Bounds().Dx() != tt.width {
+			t.Fatalf("orientation %d: expected width %d, got %d", tt.orientation, tt.width, dst.Bounds().Dx())
+		}
+		for i, v := range tt.expected {
+			if dst.Pix[i*4] != v {
+				t.Errorf("orientation %d: expected %v at index %d, got %v", tt.orientation, v, i, dst.Pix[i*4])
+			}
+		}
+	}
+}
+
+func TestLoadGrayMat(t *testing.T) {
+	// 8x4 image with a white left half, stored with the "rotate 90 CW" EXIF orientation,
+	// so the white half should end up at the top of the 4x8 oriented image.
+	src := image.NewGray(image.Rect(0, 0, 8, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			src.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	exif := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], exifOrientationTag)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], 6)
+	app1 := append([]byte("Exif\x00\x00"), append(exif, entry...)...)
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(app1)+2))
+
+	data := append([]byte{}, buf.Bytes()[:2]...)
+	data = append(data, append(segment, app1...)...)
+	data = append(data, buf.Bytes()[2:]...)
+
+	dir, err := ioutil.TempDir("", "colidr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "map.jpg")
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ParamMap{File: file, Min: 0, Max: 1}.load(image.Pt(4, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if m.Rows() != 8 || m.Cols() != 4 {
+		t.Fatalf("expected a 4x8 parameter map, got %dx%d", m.Cols(), m.Rows())
+	}
+	if top, bottom := m.GetFloatAt(1, 2), m.GetFloatAt(6, 2); top < 0.9 || bottom > 0.1 {
+		t.Errorf("expected the EXIF orientation to be applied, got %v at the top and %v at the bottom", top, bottom)
+	}
+}
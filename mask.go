@@ -0,0 +1,99 @@
+package colidr
+
+import (
+	"fmt"
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// newMask builds the region of interest weight matrix from the mask image or the rectangular ROI
+// provided in the options. The mask values are in the [0, 1] range, where 1 marks the subject.
+// It returns nil if neither a mask image nor a ROI has been provided.
+func newMask(opts Options, size image.Point) (*gocv.Mat, error) {
+	var mask gocv.Mat
+
+	switch {
+	case opts.MaskFile != "":
+		src, err := loadGrayMat(opts.MaskFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the mask image: %v", err)
+		}
+		defer src.Close()
+
+		gocv.Resize(src, &src, size, 0, 0, gocv.InterpolationLinear)
+		mask = gocv.NewMat()
+		src.ConvertTo(&mask, gocv.MatTypeCV32F, 1.0/255.0)
+	case !opts.ROI.Empty():
+		rect := opts.ROI.Intersect(image.Rect(0, 0, size.X, size.Y))
+		if rect.Empty() {
+			return nil, fmt.Errorf("the region of interest %v is outside of the image bounds", opts.ROI)
+		}
+		mask = gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), size.Y, size.X, gocv.MatTypeCV32F)
+		roi := mask.Region(rect)
+		roi.SetTo(gocv.NewScalar(1, 0, 0, 0))
+		roi.Close()
+	default:
+		return nil, nil
+	}
+
+	// Feather the mask edges for a smooth transition between the inner and outer region.
+	if opts.MaskFeather > 0 {
+		ksize := 2*opts.MaskFeather + 1
+		gocv.GaussianBlur(mask, &mask, image.Point{ksize, ksize}, 0, 0, gocv.BorderReplicate)
+	}
+	return &mask, nil
+}
+
+// hasOuterParams reports whether the region outside of the mask should be rendered
+// with its own Tau and SigmaM values instead of being left blank.
+func (c *Cld) hasOuterParams() bool {
+	return c.OuterTau > 0 || c.OuterSigmaM > 0
+}
+
+// applyMask blends the inner and outer region of the result using the mask as weight.
+// The outer region is either left blank or thresholded with the outer Tau and SigmaM values.
+func (c *Cld) applyMask() {
+	rows, cols := c.result.Rows(), c.result.Cols()
+
+	outer := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(255, 0, 0, 0), rows, cols, gocv.MatTypeCV8UC1)
+	defer outer.Close()
+
+	if c.hasOuterParams() {
+		// The outer values override the parameter maps too, which are restored once the outer region is thresholded.
+		tau, sigmaM := c.Tau, c.SigmaM
+		tauMap, sigmaMMap := c.tauMap, c.sigmaMMap
+		defer func() {
+			c.tauMap, c.sigmaMMap = tauMap, sigmaMMap
+		}()
+		if c.OuterTau > 0 {
+			tau, c.tauMap = c.OuterTau, nil
+		}
+		if c.OuterSigmaM > 0 {
+			sigmaM, c.sigmaMMap = c.OuterSigmaM, nil
+		}
+		fDog := gocv.NewMatWithSize(rows, cols, gocv.MatTypeCV32F)
+		defer fDog.Close()
+
+		c.flowDoG(&c.dog, &fDog, sigmaM)
+		c.binaryThreshold(&fDog, &outer, tau)
+	}
+
+	inner32, outer32 := gocv.NewMat(), gocv.NewMat()
+	defer inner32.Close()
+	defer outer32.Close()
+
+	c.result.ConvertTo(&inner32, gocv.MatTypeCV32F, 1.0)
+	outer.ConvertTo(&outer32, gocv.MatTypeCV32F, 1.0)
+
+	inverse := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(1, 0, 0, 0), rows, cols, gocv.MatTypeCV32F)
+	defer inverse.Close()
+	gocv.Subtract(inverse, *c.mask, &inverse)
+
+	// result = mask * inner + (1 - mask) * outer
+	gocv.Multiply(inner32, *c.mask, &inner32)
+	gocv.Multiply(outer32, inverse, &outer32)
+	gocv.Add(inner32, outer32, &inner32)
+
+	inner32.ConvertTo(&c.result, gocv.MatTypeCV8UC1, 1.0)
+}
@@ -0,0 +1,45 @@
+package colidr
+
+import (
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestCld_ApplyMaskOuterParams(t *testing.T) {
+	const size = 16
+	opts := testOptions()
+	opts.OuterTau = 0.5
+	opts.OuterSigmaM = 2
+	c := newTestCld(size, opts)
+
+	// A vertical step edge: negative DoG responses on the left half.
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			v := float32(0.1)
+			if x < size/2 {
+				v = -0.5
+			}
+			c.dog.SetFloatAt(y, x, v)
+		}
+	}
+	// The whole image is outside of the mask, while the parameter maps would leave it blank.
+	mask := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), size, size, gocv.MatTypeCV32F)
+	defer mask.Close()
+	tauMap := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), size, size, gocv.MatTypeCV32F)
+	defer tauMap.Close()
+	sigmaMMap := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(5, 0, 0, 0), size, size, gocv.MatTypeCV32F)
+	defer sigmaMMap.Close()
+	c.mask, c.tauMap, c.sigmaMMap = &mask, &tauMap, &sigmaMMap
+
+	c.applyMask()
+
+	for y := 0; y < size; y++ {
+		if l, r := c.result.GetUCharAt(y, 2), c.result.GetUCharAt(y, size-3); l != 0 || r != 255 {
+			t.Fatalf("expected the outer Tau to override the Tau map at row %d, got %d and %d", y, l, r)
+		}
+	}
+	if c.tauMap != &tauMap || c.sigmaMMap != &sigmaMMap {
+		t.Error("expected the parameter maps to be restored")
+	}
+}
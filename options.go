@@ -0,0 +1,166 @@
+package colidr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// minSigma is the lowest sigma value accepted by the sigma options and parameter maps.
+const minSigma = 0.01
+
+// FieldError describes a single invalid Options field.
+type FieldError struct {
+	Field  string
+	Value  interface{}
+	Reason string
+}
+
+// Error implements the error interface.
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: invalid value %v, %s", e.Field, e.Value, e.Reason)
+}
+
+// ValidationError holds all the field errors found while validating the Options.
+type ValidationError []FieldError
+
+// Error implements the error interface.
+func (v ValidationError) Error() string {
+	msgs := make([]string, len(v))
+	for i, e := range v {
+		msgs[i] = e.Error()
+	}
+	return "invalid options: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks the Options values and returns a ValidationError
+// listing every field which would make the CLD computation fail or produce a degenerate result.
+func (opts Options) Validate() error {
+	var errs ValidationError
+
+	// NaN values pass all the range checks, so they are rejected first.
+	for _, f := range []struct {
+		field string
+		value float64
+	}{
+		{"SigmaR", opts.SigmaR},
+		{"SigmaM", opts.SigmaM},
+		{"SigmaC", opts.SigmaC},
+		{"Rho", opts.Rho},
+		{"Tau", float64(opts.Tau)},
+		{"OuterTau", float64(opts.OuterTau)},
+		{"OuterSigmaM", opts.OuterSigmaM},
+		{"InkDensity", opts.InkDensity},
+		{"TaperWidth", opts.TaperWidth},
+		{"MinElongation", opts.MinElongation},
+		{"HysteresisTau", float64(opts.HysteresisTau)},
+		{"PaperGrain", opts.PaperGrain},
+		{"EdgeDarkening", opts.EdgeDarkening},
+		{"Wobble", opts.Wobble},
+	} {
+		if math.IsNaN(f.value) {
+			errs = append(errs, FieldError{f.field, f.value, "must be a number"})
+		}
+	}
+
+	if opts.SigmaR < minSigma {
+		errs = append(errs, FieldError{"SigmaR", opts.SigmaR, fmt.Sprintf("must be at least %v", minSigma)})
+	}
+	if opts.SigmaM < minSigma {
+		errs = append(errs, FieldError{"SigmaM", opts.SigmaM, fmt.Sprintf("must be at least %v", minSigma)})
+	}
+	if opts.SigmaC < minSigma {
+		errs = append(errs, FieldError{"SigmaC", opts.SigmaC, fmt.Sprintf("must be at least %v", minSigma)})
+	}
+	if opts.Tau < 0 || opts.Tau > 1 {
+		errs = append(errs, FieldError{"Tau", opts.Tau, "must be in the [0, 1] range"})
+	}
+	if opts.BlurSize <= 0 || opts.BlurSize%2 == 0 {
+		errs = append(errs, FieldError{"BlurSize", opts.BlurSize, "must be a positive odd number"})
+	}
+	if opts.HysteresisTau < 0 || opts.HysteresisTau > 1 {
+		errs = append(errs, FieldError{"HysteresisTau", opts.HysteresisTau, "must be in the [0, 1] range"})
+	} else if opts.HysteresisTau > 0 && opts.AutoTau == "" && opts.HysteresisTau <= opts.Tau {
+		errs = append(errs, FieldError{"HysteresisTau", opts.HysteresisTau, "must be greater than Tau"})
+	}
+	if opts.EtfIteration < 0 {
+		errs = append(errs, FieldError{"EtfIteration", opts.EtfIteration, "must not be negative"})
+	}
+	if opts.EtfKernel < 0 || (opts.EtfIteration > 0 && opts.EtfKernel == 0) {
+		errs = append(errs, FieldError{"EtfKernel", opts.EtfKernel, "must be greater than 0"})
+	}
+	if opts.FDogIteration < 0 {
+		errs = append(errs, FieldError{"FDogIteration", opts.FDogIteration, "must not be negative"})
+	}
+	if opts.MaskFile != "" && !opts.ROI.Empty() {
+		errs = append(errs, FieldError{"ROI", opts.ROI, "cannot be used together with a mask image"})
+	}
+	if opts.MaskFeather < 0 {
+		errs = append(errs, FieldError{"MaskFeather", opts.MaskFeather, "must not be negative"})
+	}
+	if opts.OuterTau < 0 || opts.OuterTau > 1 {
+		errs = append(errs, FieldError{"OuterTau", opts.OuterTau, "must be in the [0, 1] range"})
+	}
+	if opts.OuterSigmaM < 0 || (opts.OuterSigmaM > 0 && opts.OuterSigmaM < minSigma) {
+		errs = append(errs, FieldError{"OuterSigmaM", opts.OuterSigmaM, fmt.Sprintf("must be 0 or at least %v", minSigma)})
+	}
+
+	if opts.TaperWidth < 0 {
+		errs = append(errs, FieldError{"TaperWidth", opts.TaperWidth, "must not be negative"})
+	}
+	if opts.MinLineLength < 0 {
+		errs = append(errs, FieldError{"MinLineLength", opts.MinLineLength, "must not be negative"})
+	}
+	if opts.MinComponentArea < 0 {
+		errs = append(errs, FieldError{"MinComponentArea", opts.MinComponentArea, "must not be negative"})
+	}
+	if opts.MinElongation < 0 {
+		errs = append(errs, FieldError{"MinElongation", opts.MinElongation, "must not be negative"})
+	}
+	if opts.BridgeGap < 0 {
+		errs = append(errs, FieldError{"BridgeGap", opts.BridgeGap, "must not be negative"})
+	}
+	if opts.VizNoiseScale < 0 {
+		errs = append(errs, FieldError{"VizNoiseScale", opts.VizNoiseScale, "must not be negative"})
+	}
+	if opts.VizLength < 0 {
+		errs = append(errs, FieldError{"VizLength", opts.VizLength, "must not be negative"})
+	}
+	if opts.PaperGrain < 0 || opts.PaperGrain > 1 {
+		errs = append(errs, FieldError{"PaperGrain", opts.PaperGrain, "must be in the [0, 1] range"})
+	}
+	if opts.EdgeDarkening < 0 || opts.EdgeDarkening > 1 {
+		errs = append(errs, FieldError{"EdgeDarkening", opts.EdgeDarkening, "must be in the [0, 1] range"})
+	}
+	if opts.Wobble < 0 {
+		errs = append(errs, FieldError{"Wobble", opts.Wobble, "must not be negative"})
+	}
+	switch opts.GradientOperator {
+	case "", GradientSobel, GradientScharr, GradientPrewitt:
+	default:
+		errs = append(errs, FieldError{"GradientOperator", opts.GradientOperator, "must be one of sobel, scharr or prewitt"})
+	}
+	switch opts.AutoTau {
+	case "", AutoTauOtsu:
+	case AutoTauDensity:
+		if opts.InkDensity <= 0 || opts.InkDensity >= 100 {
+			errs = append(errs, FieldError{"InkDensity", opts.InkDensity, "must be in the (0, 100) range"})
+		}
+	default:
+		errs = append(errs, FieldError{"AutoTau", opts.AutoTau, "must be one of " + AutoTauDensity + " or " + AutoTauOtsu})
+	}
+	if err := opts.TauMap.validate("TauMap", 0, 1); err != nil {
+		errs = append(errs, *err)
+	}
+	if err := opts.SigmaMMap.validate("SigmaMMap", minSigma, math.Inf(1)); err != nil {
+		errs = append(errs, *err)
+	}
+	if err := opts.SigmaCMap.validate("SigmaCMap", minSigma, math.Inf(1)); err != nil {
+		errs = append(errs, *err)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
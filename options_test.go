@@ -0,0 +1,80 @@
+package colidr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOptions_ValidateNaN(t *testing.T) {
+	nan := math.NaN()
+	for name, modify := range map[string]func(*Options){
+		"SigmaR":        func(o *Options) { o.SigmaR = nan },
+		"Rho":           func(o *Options) { o.Rho = nan },
+		"Tau":           func(o *Options) { o.Tau = float32(nan) },
+		"HysteresisTau": func(o *Options) { o.HysteresisTau = float32(nan) },
+		"PaperGrain":    func(o *Options) { o.PaperGrain = nan },
+		"TauMap":        func(o *Options) { o.TauMap = ParamMap{File: "map.png", Min: nan, Max: 1} },
+	} {
+		opts := testOptions()
+		modify(&opts)
+
+		err := opts.Validate()
+		if err == nil {
+			t.Errorf("expected a validation error for a NaN %s", name)
+			continue
+		}
+		if errs := err.(ValidationError); len(errs) != 1 || errs[0].Field != name {
+			t.Errorf("expected a single %s field error, got %v", name, err)
+		}
+	}
+	if err := testOptions().Validate(); err != nil {
+		t.Errorf("expected the default options to be valid, got %v", err)
+	}
+}
+
+func TestOptions_ValidateSigma(t *testing.T) {
+	for name, modify := range map[string]func(*Options){
+		"SigmaR":      func(o *Options) { o.SigmaR = 0.001 },
+		"SigmaM":      func(o *Options) { o.SigmaM = 0 },
+		"SigmaC":      func(o *Options) { o.SigmaC = 0.004 },
+		"OuterSigmaM": func(o *Options) { o.OuterSigmaM = 0.005 },
+	} {
+		opts := testOptions()
+		modify(&opts)
+
+		err := opts.Validate()
+		if err == nil {
+			t.Errorf("expected a validation error for a %s below the minimum sigma", name)
+			continue
+		}
+		if errs := err.(ValidationError); len(errs) != 1 || errs[0].Field != name {
+			t.Errorf("expected a single %s field error, got %v", name, err)
+		}
+	}
+}
+
+func TestOptions_ValidateHysteresisTau(t *testing.T) {
+	tests := []struct {
+		offset float32
+		valid  bool
+	}{
+		{-0.01, false},
+		{0, false},
+		{0.01, true},
+	}
+	for _, tt := range tests {
+		opts := testOptions()
+		opts.HysteresisTau = opts.Tau + tt.offset
+
+		err := opts.Validate()
+		if tt.valid && err != nil {
+			t.Errorf("expected HysteresisTau %v to be valid with Tau %v, got %v", opts.HysteresisTau, opts.Tau, err)
+		}
+		if !tt.valid {
+			errs, ok := err.(ValidationError)
+			if !ok || len(errs) != 1 || errs[0].Field != "HysteresisTau" {
+				t.Errorf("expected a single HysteresisTau field error for HysteresisTau %v and Tau %v, got %v", opts.HysteresisTau, opts.Tau, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package colidr
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+
+	"gocv.io/x/gocv"
+)
+
+// wobbleScale is the size in pixels of the noise cells driving the line displacement.
+const wobbleScale = 24
+
+// paperColor is the base color of the procedural paper texture, in BGR order.
+var paperColor = [3]float64{228, 240, 245}
+
+// paperOctaves are the noise cell sizes and amplitudes of the procedural paper grain.
+var paperOctaves = []struct {
+	cell, amplitude float64
+}{
+	{64, 0.4},
+	{16, 0.3},
+	{4, 0.2},
+	{1, 0.1},
+}
+
+// paperEnabled checks if the paper compositing stage is enabled.
+func (opts Options) paperEnabled() bool {
+	return opts.Paper || opts.PaperFile != ""
+}
+
+// newPaper returns the paper texture as a BGR matrix of the provided size: the paper file resized,
+// or a procedurally generated texture if no file is provided. It returns nil if the stage is not enabled.
+func newPaper(opts Options, size image.Point) (*gocv.Mat, error) {
+	if !opts.paperEnabled() {
+		return nil, nil
+	}
+	if opts.PaperFile != "" {
+		img, err := LoadImage(opts.PaperFile, nil)
+		if err != nil {
+			return nil, err
+		}
+		paper := imageToMat(img)
+		gocv.Resize(paper, &paper, size, 0, 0, gocv.InterpolationLinear)
+		return &paper, nil
+	}
+
+	rnd := rand.New(rand.NewSource(noiseSeed(opts.PaperSeed)))
+	grain := make([]float64, size.X*size.Y)
+	for _, o := range paperOctaves {
+		for i, v := range valueNoise(size.X, size.Y, o.cell, rnd) {
+			grain[i] += o.amplitude * v
+		}
+	}
+
+	// The texture is written into the matrix memory, so it doesn't depend on a Go slice.
+	paper := gocv.NewMatWithSize(size.Y, size.X, gocv.MatTypeCV8UC3)
+	data := paper.DataPtrUint8()
+	for i, g := range grain {
+		f := 1 - opts.PaperGrain*g
+		for ch := 0; ch < 3; ch++ {
+			data[3*i+ch] = uint8(paperColor[ch] * f)
+		}
+	}
+	return &paper, nil
+}
+
+// Composite returns the line drawing multiplied over the paper texture.
+// The paper compositing stage should be enabled in the options and it should be called after GenerateCld.
+func (c *Cld) Composite() (image.Image, error) {
+	if c.compositeErr != nil {
+		return nil, c.compositeErr
+	}
+	if c.composite.Empty() {
+		return nil, fmt.Errorf("the paper compositing stage is not enabled")
+	}
+	return c.composite.ToImage()
+}
+
+// compositePaper multiplies the line layer over the paper texture. The lines are optionally displaced
+// along the flow normal and their interior is lightened relative to their edges,
+// resembling the pigment accumulation of the watercolour strokes. The line drawing itself is not modified.
+func (c *Cld) compositePaper() error {
+	width, height := c.result.Cols(), c.result.Rows()
+
+	lines := c.result.ToBytes()
+	coverage := make([]float64, len(lines))
+	for i, v := range lines {
+		coverage[i] = 1 - float64(v)/255
+	}
+	if c.Wobble > 0 {
+		var err error
+		if coverage, err = c.wobble(coverage, width, height); err != nil {
+			return err
+		}
+	}
+	if c.EdgeDarkening > 0 {
+		coverage = darkenEdges(coverage, width, height, c.EdgeDarkening)
+	}
+
+	paper := c.paper.DataPtrUint8()
+	composite := gocv.NewMatWithSize(height, width, gocv.MatTypeCV8UC3)
+	data := composite.DataPtrUint8()
+	for i, a := range coverage {
+		for ch := 0; ch < 3; ch++ {
+			data[3*i+ch] = uint8(float64(paper[3*i+ch]) * (1 - a))
+		}
+	}
+	c.composite = composite
+	return nil
+}
+
+// wobble displaces the line coverage along the flow normal by a smoothly varying offset,
+// the maximum displacement being given by the Wobble option.
+func (c *Cld) wobble(coverage []float64, width, height int) ([]float64, error) {
+	rnd := rand.New(rand.NewSource(noiseSeed(c.PaperSeed)))
+	noise := valueNoise(width, height, wobbleScale, rnd)
+
+	flow, err := c.etf.flowField.DataPtrFloat32()
+	if err != nil {
+		return nil, err
+	}
+
+	dst := make([]float64, len(coverage))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			idx := y*width + x
+			nx, ny := float64(-flow[3*idx]), float64(flow[3*idx+1])
+			d := c.Wobble * (2*noise[idx] - 1)
+
+			dst[idx] = bilinear(coverage, width, height, float64(x)-nx*d, float64(y)-ny*d)
+		}
+	}
+	return dst, nil
+}
+
+// darkenEdges lightens the interior of the strokes by the provided factor, keeping the coverage of their edges.
+// The edges are detected as the pixels having a larger coverage than their neighbourhood.
+func darkenEdges(coverage []float64, width, height int, factor float64) []float64 {
+	blurred := boxBlur(coverage, width, height, 2)
+
+	dst := make([]float64, len(coverage))
+	for i, a := range coverage {
+		edge := math.Min(math.Max(4*(a-blurred[i]), 0), 1)
+		dst[i] = a * (1 - factor + factor*edge)
+	}
+	return dst
+}
+
+// boxBlur averages the values over a (2*radius+1) sized square window, replicating the borders.
+func boxBlur(values []float64, width, height, radius int) []float64 {
+	tmp := make([]float64, len(values))
+	dst := make([]float64, len(values))
+	n := float64(2*radius + 1)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum float64
+			for k := -radius; k <= radius; k++ {
+				sum += values[y*width+clampInt(x+k, 0, width-1)]
+			}
+			tmp[y*width+x] = sum / n
+		}
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum float64
+			for k := -radius; k <= radius; k++ {
+				sum += tmp[clampInt(y+k, 0, height-1)*width+x]
+			}
+			dst[y*width+x] = sum / n
+		}
+	}
+	return dst
+}
+
+// bilinear returns the bilinearly interpolated value at the (x, y) position, clamped to the bounds.
+func bilinear(values []float64, width, height int, x, y float64) float64 {
+	x = math.Min(math.Max(x, 0), float64(width-1))
+	y = math.Min(math.Max(y, 0), float64(height-1))
+
+	x0, y0 := int(x), int(y)
+	x1, y1 := clampInt(x0+1, 0, width-1), clampInt(y0+1, 0, height-1)
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	return values[y0*width+x0]*(1-fx)*(1-fy) +
+		values[y0*width+x1]*fx*(1-fy) +
+		values[y1*width+x0]*(1-fx)*fy +
+		values[y1*width+x1]*fx*fy
+}
+
+// valueNoise generates a smooth noise in the [0, 1] range by interpolating random values
+// placed on a grid having the provided cell size.
+func valueNoise(width, height int, cell float64, rnd *rand.Rand) []float64 {
+	cols, rows := int(float64(width)/cell)+2, int(float64(height)/cell)+2
+	grid := make([]float64, cols*rows)
+	for i := range grid {
+		grid[i] = rnd.Float64()
+	}
+
+	smooth := func(t float64) float64 { return t * t * (3 - 2*t) }
+	noise := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		gy := float64(y) / cell
+		y0 := int(gy)
+		ty := smooth(gy - float64(y0))
+		for x := 0; x < width; x++ {
+			gx := float64(x) / cell
+			x0 := int(gx)
+			tx := smooth(gx - float64(x0))
+
+			top := grid[y0*cols+x0]*(1-tx) + grid[y0*cols+x0+1]*tx
+			bottom := grid[(y0+1)*cols+x0]*(1-tx) + grid[(y0+1)*cols+x0+1]*tx
+			noise[y*width+x] = top*(1-ty) + bottom*ty
+		}
+	}
+	return noise
+}
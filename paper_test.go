@@ -0,0 +1,63 @@
+package colidr
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"testing"
+)
+
+func TestValueNoiseRange(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, cell := range []float64{1, 4, 24} {
+		for i, v := range valueNoise(50, 30, cell, rnd) {
+			if v < 0 || v > 1 {
+				t.Fatalf("cell %v: noise value %v at %d out of the [0, 1] range", cell, v, i)
+			}
+		}
+	}
+}
+
+func TestDarkenEdges(t *testing.T) {
+	// A 9px wide vertical stroke in the middle of a 21x5 image.
+	width, height := 21, 5
+	coverage := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 6; x < 15; x++ {
+			coverage[y*width+x] = 1
+		}
+	}
+	dst := darkenEdges(coverage, width, height, 0.5)
+
+	edge, center := dst[2*width+6], dst[2*width+10]
+	if edge != 1 {
+		t.Errorf("expected the stroke edge to keep its coverage, got %v", edge)
+	}
+	if center != 0.5 {
+		t.Errorf("expected the stroke interior to be lightened to 0.5, got %v", center)
+	}
+	if dst[2*width] != 0 {
+		t.Errorf("expected the background to stay blank, got %v", dst[2*width])
+	}
+}
+
+func TestNewPaper_Seed(t *testing.T) {
+	texture := func(seed int64) []byte {
+		paper, err := newPaper(Options{Paper: true, PaperGrain: 0.15, PaperSeed: seed}, image.Pt(40, 30))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer paper.Close()
+		return paper.ToBytes()
+	}
+
+	if !bytes.Equal(texture(0), texture(0)) {
+		t.Errorf("expected the default seed to produce the same paper texture")
+	}
+	if !bytes.Equal(texture(7), texture(7)) {
+		t.Errorf("expected the same seed to produce the same paper texture")
+	}
+	if bytes.Equal(texture(0), texture(7)) {
+		t.Errorf("expected different seeds to produce different paper textures")
+	}
+}
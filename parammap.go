@@ -0,0 +1,93 @@
+package colidr
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sync"
+
+	"gocv.io/x/gocv"
+)
+
+// ParamMap describes a spatially varying parameter defined by a grayscale image.
+// The pixel intensities of the image are linearly mapped into the [Min, Max] range,
+// so that black corresponds to Min and white corresponds to Max.
+// When a parameter map is provided it takes precedence over the global parameter value.
+type ParamMap struct {
+	File string
+	Min  float64
+	Max  float64
+}
+
+// sigmaStep is the quantization step of the sigma values read from the parameter maps,
+// bounding the number of gaussian vectors computed for them.
+const sigmaStep = 0.01
+
+// gaussianCache caches the gaussian vectors for the different sigma values.
+type gaussianCache struct {
+	mu      sync.Mutex
+	vectors map[float64][]float64
+}
+
+// gauCache is the shared gaussian vector cache.
+var gauCache = &gaussianCache{vectors: make(map[float64][]float64)}
+
+// get returns the gaussian vector for the exact sigma value.
+func (g *gaussianCache) get(sigma float64) []float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if v, ok := g.vectors[sigma]; ok {
+		return v
+	}
+	v := makeGaussianVector(sigma)
+	g.vectors[sigma] = v
+	return v
+}
+
+// quantizeSigma rounds a sigma value read from a parameter map to the nearest multiple of sigmaStep.
+func quantizeSigma(sigma float32) float64 {
+	return math.Max(math.Round(float64(sigma)/sigmaStep), 1) * sigmaStep
+}
+
+// load reads the parameter map image and returns the matrix holding the local parameter values.
+// It returns nil if no parameter map has been provided.
+func (pm ParamMap) load(size image.Point) (*gocv.Mat, error) {
+	if pm.File == "" {
+		return nil, nil
+	}
+	src, err := loadGrayMat(pm.File)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the parameter map: %v", err)
+	}
+	defer src.Close()
+
+	gocv.Resize(src, &src, size, 0, 0, gocv.InterpolationLinear)
+
+	m := gocv.NewMat()
+	src.ConvertTo(&m, gocv.MatTypeCV32F, (pm.Max-pm.Min)/255.0)
+	m.AddFloat(float32(pm.Min))
+
+	return &m, nil
+}
+
+// validate checks if the parameter map range is inside the [lo, hi] interval.
+func (pm ParamMap) validate(field string, lo, hi float64) *FieldError {
+	if pm.File == "" {
+		return nil
+	}
+	if math.IsNaN(pm.Min) || math.IsNaN(pm.Max) || pm.Min < lo || pm.Max > hi || pm.Min > pm.Max {
+		return &FieldError{field, fmt.Sprintf("[%v, %v]", pm.Min, pm.Max), fmt.Sprintf("must be an ordered range inside [%v, %v]", lo, hi)}
+	}
+	return nil
+}
+
+// paramData returns the local parameter values of the parameter map in row-major order,
+// or nil if no parameter map is present.
+func paramData(m *gocv.Mat) []float32 {
+	if m == nil {
+		return nil
+	}
+	data, _ := m.DataPtrFloat32()
+	return data
+}
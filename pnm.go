@@ -0,0 +1,65 @@
+package colidr
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// EncodePBM writes the image in binary PBM (P4) format.
+// The pixels darker than the middle gray are considered black.
+func EncodePBM(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "P4\n%d %d\n", b.Dx(), b.Dy())
+
+	// Contrary to TIFF, the black pixels are stored as 1 bits.
+	pix := packBits(img)
+	for i := range pix {
+		pix[i] = ^pix[i]
+	}
+	// Clear the padding bits at the end of each row.
+	stride := (b.Dx() + 7) / 8
+	if pad := uint(stride*8 - b.Dx()); pad > 0 {
+		for i := stride - 1; i < len(pix); i += stride {
+			pix[i] &^= 1<<pad - 1
+		}
+	}
+	buf.Write(pix)
+
+	return buf.Flush()
+}
+
+// EncodePGM writes the image in binary 8-bit PGM (P5) format.
+func EncodePGM(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "P5\n%d %d\n255\n", b.Dx(), b.Dy())
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			buf.WriteByte(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+		}
+	}
+	return buf.Flush()
+}
+
+// EncodePFM writes the float image in grayscale PFM format.
+// The PFM rows are stored from bottom to top, the negative scale denoting little endian values.
+func (f *FloatImage) EncodePFM(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "Pf\n%d %d\n-1.0\n", f.Width, f.Height)
+
+	var data [4]byte
+	for y := f.Height - 1; y >= 0; y-- {
+		for _, v := range f.Pix[y*f.Width : (y+1)*f.Width] {
+			binary.LittleEndian.PutUint32(data[:], math.Float32bits(v))
+			buf.Write(data[:])
+		}
+	}
+	return buf.Flush()
+}
@@ -0,0 +1,63 @@
+package colidr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestEncodePBM(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 10, 2))
+	for i := range src.Pix {
+		src.Pix[i] = 255
+	}
+	src.SetGray(0, 0, color.Gray{Y: 0})
+	src.SetGray(9, 1, color.Gray{Y: 100})
+
+	var buf bytes.Buffer
+	if err := EncodePBM(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	// The rows are padded to byte boundary, the black pixels being stored as 1 bits.
+	expected := append([]byte("P4\n10 2\n"), 0x80, 0x00, 0x00, 0x40)
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("expected %v, got %v", expected, buf.Bytes())
+	}
+}
+
+func TestEncodePGM(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 3, 1))
+	copy(src.Pix, []byte{0, 128, 255})
+
+	var buf bytes.Buffer
+	if err := EncodePGM(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	expected := append([]byte("P5\n3 1\n255\n"), 0, 128, 255)
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("expected %v, got %v", expected, buf.Bytes())
+	}
+}
+
+func TestFloatImage_EncodePFM(t *testing.T) {
+	f := &FloatImage{Width: 2, Height: 2, Pix: []float32{0, 0.25, 0.5, 1}}
+
+	var buf bytes.Buffer
+	if err := f.EncodePFM(&buf); err != nil {
+		t.Fatal(err)
+	}
+	header := "Pf\n2 2\n-1.0\n"
+	if got := buf.String()[:len(header)]; got != header {
+		t.Fatalf("expected header %q, got %q", header, got)
+	}
+	// The rows are stored from bottom to top.
+	data := buf.Bytes()[len(header):]
+	for i, expected := range []float32{0.5, 1, 0, 0.25} {
+		if v := math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:])); v != expected {
+			t.Errorf("expected value %v at index %d, got %v", expected, i, v)
+		}
+	}
+}
@@ -8,6 +8,16 @@ import (
 
 type kernel [][]int32
 
+// GradientOperator is the convolution kernel pair used for computing the image gradient.
+type GradientOperator string
+
+// The supported gradient operators.
+const (
+	GradientSobel   GradientOperator = "sobel"
+	GradientScharr  GradientOperator = "scharr"
+	GradientPrewitt GradientOperator = "prewitt"
+)
+
 var (
 	kernelX = kernel{
 		{-1, 0, 1},
@@ -20,82 +30,139 @@ var (
 		{0, 0, 0},
 		{1, 2, 1},
 	}
+
+	scharrX = kernel{
+		{-3, 0, 3},
+		{-10, 0, 10},
+		{-3, 0, 3},
+	}
+
+	scharrY = kernel{
+		{-3, -10, -3},
+		{0, 0, 0},
+		{3, 10, 3},
+	}
+
+	prewittX = kernel{
+		{-1, 0, 1},
+		{-1, 0, 1},
+		{-1, 0, 1},
+	}
+
+	prewittY = kernel{
+		{-1, -1, -1},
+		{0, 0, 0},
+		{1, 1, 1},
+	}
 )
 
-// Sobel uses the sobel threshold operator for edge detection.
-// See https://en.wikipedia.org/wiki/Sobel_operator
-func Sobel(img *image.NRGBA, threshold float64) *image.NRGBA {
-	var sumX, sumY int32
-	dx, dy := img.Bounds().Max.X, img.Bounds().Max.Y
-	dst := image.NewNRGBA(img.Bounds())
-
-	// Get 3x3 window of pixels because image data given is just a 1D array of pixels
-	maxPixelOffset := dx*2 + len(kernelX) - 1
-
-	data := getImageData(img)
-	length := len(data)*4 - maxPixelOffset
-	magnitudes := make([]uint8, length)
-
-	for i := 0; i < length; i++ {
-		// Sum each pixel with the kernel value
-		sumX, sumY = 0, 0
-		for x := 0; x < len(kernelX); x++ {
-			for y := 0; y < len(kernelY); y++ {
-				if idx := i + (dx * y) + x; idx < len(data) {
-					r := data[i+(dx*y)+x]
-					sumX += int32(r) * kernelX[y][x]
-					sumY += int32(r) * kernelY[y][x]
-				}
-			}
-		}
-		magnitude := math.Sqrt(float64(sumX*sumX) + float64(sumY*sumY))
-		// Check for pixel color boundaries
-		if magnitude < 0 {
-			magnitude = 0
-		} else if magnitude > 255 {
-			magnitude = 255
-		}
+// kernels returns the horizontal and vertical kernels of the gradient operator.
+func (op GradientOperator) kernels() (kernel, kernel, bool) {
+	switch op {
+	case GradientSobel:
+		return kernelX, kernelY, true
+	case GradientScharr:
+		return scharrX, scharrY, true
+	case GradientPrewitt:
+		return prewittX, prewittY, true
+	}
+	return nil, nil, false
+}
 
-		// Set magnitude to 0 if doesn't exceed threshold, else set to magnitude
-		if magnitude > threshold {
-			magnitudes[i] = uint8(magnitude)
-		} else {
-			magnitudes[i] = 0
-		}
+// GradientField holds the image gradient computed by a gradient operator.
+// The values are stored in row-major order, the luminance being in the [0, 255] range.
+type GradientField struct {
+	Width       int
+	Height      int
+	X           []float64
+	Y           []float64
+	Magnitude   []float64
+	Orientation []float64
+}
+
+// At returns the horizontal and vertical gradient at the (x, y) position.
+func (g *GradientField) At(x, y int) (float64, float64) {
+	idx := y*g.Width + x
+	return g.X[idx], g.Y[idx]
+}
+
+// Gradient computes the horizontal and vertical derivatives of the image luminance using the provided operator,
+// together with the gradient magnitude and orientation (in radians). The image borders are replicated.
+// If the operator is not supported the Sobel operator is used.
+func Gradient(img image.Image, op GradientOperator) *GradientField {
+	kx, ky, ok := op.kernels()
+	if !ok {
+		kx, ky = kernelX, kernelY
+	}
+	lum := getImageData(img)
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	g := &GradientField{
+		Width:       width,
+		Height:      height,
+		X:           make([]float64, width*height),
+		Y:           make([]float64, width*height),
+		Magnitude:   make([]float64, width*height),
+		Orientation: make([]float64, width*height),
 	}
 
-	dataLength := dx * dy * 4
-	edges := make([]int32, dataLength)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sumX, sumY float64
+			// Sum each pixel of the 3x3 window with the kernel value.
+			for j := 0; j < 3; j++ {
+				for i := 0; i < 3; i++ {
+					px := clampInt(x+i-1, 0, width-1)
+					py := clampInt(y+j-1, 0, height-1)
+					v := lum[py*width+px]
 
-	// Apply the kernel values
-	for i := 0; i < dataLength; i++ {
-		edges[i] = 0
-		if i%4 != 0 {
-			m := magnitudes[i/4]
-			if m != 0 {
-				edges[i-1] = int32(m)
+					sumX += v * float64(kx[j][i])
+					sumY += v * float64(ky[j][i])
+				}
 			}
+			idx := y*width + x
+			g.X[idx] = sumX
+			g.Y[idx] = sumY
+			g.Magnitude[idx] = math.Sqrt(sumX*sumX + sumY*sumY)
+			g.Orientation[idx] = math.Atan2(sumY, sumX)
 		}
 	}
+	return g
+}
 
-	// Generate the new image with the sobel filter applied
-	for idx := 0; idx < len(edges); idx += 4 {
-		dst.Pix[idx] = uint8(edges[idx])
-		dst.Pix[idx+1] = uint8(edges[idx+1])
-		dst.Pix[idx+2] = uint8(edges[idx+2])
-		dst.Pix[idx+3] = 255
+// Sobel uses the sobel threshold operator for edge detection.
+// The gradient magnitudes exceeding the threshold are returned as a grayscale image.
+// See https://en.wikipedia.org/wiki/Sobel_operator
+func Sobel(img image.Image, threshold float64) *image.NRGBA {
+	g := Gradient(img, GradientSobel)
+	dst := image.NewNRGBA(image.Rect(0, 0, g.Width, g.Height))
+
+	for y := 0; y < g.Height; y++ {
+		for x := 0; x < g.Width; x++ {
+			magnitude := math.Min(g.Magnitude[y*g.Width+x], 255)
+
+			// Set magnitude to 0 if doesn't exceed threshold, else set to magnitude
+			if magnitude <= threshold {
+				magnitude = 0
+			}
+			v := uint8(magnitude)
+			dst.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
 	}
 	return dst
 }
 
-// getImageData returns an array of pixel grayscale brightness values
-// for the image (taking the red component of each pixel).
-func getImageData(img *image.NRGBA) []uint8 {
-	dx, dy := img.Bounds().Max.X, img.Bounds().Max.Y
-	pixels := make([]uint8, dx*dy)
+// getImageData returns an array of pixel grayscale brightness values in row-major order.
+func getImageData(img image.Image) []float64 {
+	bounds := img.Bounds()
+	pixels := make([]float64, bounds.Dx()*bounds.Dy())
 
-	for i := range pixels {
-		pixels[i] = img.Pix[i*4]
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			lum := float64(r)*0.299 + float64(g)*0.587 + float64(b)*0.114
+			pixels[(y-bounds.Min.Y)*bounds.Dx()+(x-bounds.Min.X)] = lum / 257
+		}
 	}
 	return pixels
 }
@@ -114,3 +181,14 @@ func toGrayScale(src *image.NRGBA) *image.NRGBA {
 	}
 	return dst
 }
+
+// clampInt restricts the value into the [lo, hi] range.
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
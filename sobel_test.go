@@ -0,0 +1,83 @@
+package colidr
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestSobel(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			var v uint8 = 20
+			if x >= 8 {
+				v = 200
+			}
+			src.Set(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	dst := Sobel(src, 10)
+
+	if dst.Bounds() != src.Bounds() {
+		t.Fatalf("expected the output bounds to be %v, got %v", src.Bounds(), dst.Bounds())
+	}
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			c := dst.NRGBAAt(x, y)
+			if c.A != 255 {
+				t.Fatalf("expected an opaque output image")
+			}
+			edge := x == 7 || x == 8
+			if edge && c.R != 255 {
+				t.Errorf("expected an edge at (%d, %d), got %d", x, y, c.R)
+			}
+			if !edge && c.R != 0 {
+				t.Errorf("expected no edge at (%d, %d), got %d", x, y, c.R)
+			}
+		}
+	}
+}
+
+func TestGradient(t *testing.T) {
+	// Horizontal ramp: the luminance increases by 10 on each column.
+	src := image.NewGray(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			src.SetGray(x, y, color.Gray{Y: uint8(x * 10)})
+		}
+	}
+
+	tests := []struct {
+		op       GradientOperator
+		expected float64
+	}{
+		{GradientSobel, 80},
+		{GradientScharr, 320},
+		{GradientPrewitt, 60},
+	}
+	for _, tt := range tests {
+		g := Gradient(src, tt.op)
+
+		gx, gy := g.At(4, 4)
+		if math.Abs(gx-tt.expected) > 1e-6 || math.Abs(gy) > 1e-6 {
+			t.Errorf("%s: expected gradient (%v, 0), got (%v, %v)", tt.op, tt.expected, gx, gy)
+		}
+		if m := g.Magnitude[4*g.Width+4]; math.Abs(m-tt.expected) > 1e-6 {
+			t.Errorf("%s: expected magnitude %v, got %v", tt.op, tt.expected, m)
+		}
+		if o := g.Orientation[4*g.Width+4]; math.Abs(o) > 1e-6 {
+			t.Errorf("%s: expected orientation 0, got %v", tt.op, o)
+		}
+	}
+}
+
+func BenchmarkSobel(b *testing.B) {
+	src := loadFixture(b, "circle")
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		Sobel(src, 20)
+	}
+}
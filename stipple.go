@@ -0,0 +1,302 @@
+package colidr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"math/rand"
+
+	"gocv.io/x/gocv"
+)
+
+// The default stippling values.
+const (
+	defaultStipplePoints     = 5000
+	defaultStippleIterations = 10
+	defaultStippleMinRadius  = 0.5
+	defaultStippleMaxRadius  = 2.0
+)
+
+// StippleOptions contains the options of the weighted Voronoi stippling.
+type StippleOptions struct {
+	// Points is the number of dots.
+	Points int
+	// Iterations is the number of Lloyd relaxation steps.
+	Iterations int
+	// MinRadius and MaxRadius define the dot size range, the dots being larger in the darker regions.
+	MinRadius float64
+	MaxRadius float64
+	// LineWeight is the density added along the coherent line drawing. Zero disables the line emphasis.
+	LineWeight float64
+	// Seed is the seed of the initial dot distribution.
+	// If it's zero the default seed is used and if it's negative a random one.
+	Seed int64
+}
+
+// Dot is a stipple dot.
+type Dot struct {
+	X, Y, R float64
+}
+
+// Stippling holds the stipple dots.
+type Stippling struct {
+	Width  int
+	Height int
+	Dots   []Dot
+}
+
+// Image returns the rasterized stippling.
+func (s *Stippling) Image() *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, s.Width, s.Height))
+	for i := range dst.Pix {
+		dst.Pix[i] = 255
+	}
+	black := color.NRGBA{A: 255}
+
+	for _, d := range s.Dots {
+		r := math.Max(d.R, 0.5)
+		for y := int(d.Y - r); y <= int(d.Y+r); y++ {
+			for x := int(d.X - r); x <= int(d.X+r); x++ {
+				dx, dy := float64(x)+0.5-d.X, float64(y)+0.5-d.Y
+				if dx*dx+dy*dy <= r*r || (x == int(d.X) && y == int(d.Y)) {
+					dst.SetNRGBA(x, y, black)
+				}
+			}
+		}
+	}
+	return dst
+}
+
+// EncodePNG writes the rasterized stippling in PNG format.
+func (s *Stippling) EncodePNG(w io.Writer) error {
+	return png.Encode(w, s.Image())
+}
+
+// EncodeSVG writes the stippling in SVG format, each dot being a circle.
+func (s *Stippling) EncodeSVG(w io.Writer) error {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(&buf, "<svg xmlns=\"http://www.w3.org/2000/svg\" version=\"1.1\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n",
+		s.Width, s.Height, s.Width, s.Height)
+	fmt.Fprintf(&buf, "<rect width=\"100%%\" height=\"100%%\" fill=\"#ffffff\"/>\n<g fill=\"#000000\">\n")
+	for _, d := range s.Dots {
+		fmt.Fprintf(&buf, "<circle cx=\"%.2f\" cy=\"%.2f\" r=\"%.2f\"/>\n", d.X, d.Y, d.R)
+	}
+	buf.WriteString("</g>\n</svg>\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Stipple places dots using weighted Voronoi stippling: the dots are initially distributed
+// in function of the source image darkness, then moved iteratively to the weighted centroids of their Voronoi cells.
+// The density is increased along the coherent line drawing, so it should be called after GenerateCld.
+func (c *Cld) Stipple(opts StippleOptions) (*Stippling, error) {
+	if opts.Points <= 0 {
+		opts.Points = defaultStipplePoints
+	}
+	if opts.Iterations <= 0 {
+		opts.Iterations = defaultStippleIterations
+	}
+	if opts.MinRadius <= 0 {
+		opts.MinRadius = defaultStippleMinRadius
+	}
+	if opts.MaxRadius <= 0 {
+		opts.MaxRadius = defaultStippleMaxRadius
+	}
+	if opts.LineWeight < 0 {
+		return nil, fmt.Errorf("the line weight should not be negative")
+	}
+	if opts.MinRadius > opts.MaxRadius {
+		return nil, fmt.Errorf("the minimum dot radius should not exceed the maximum radius")
+	}
+
+	density := c.stippleDensity(opts.LineWeight)
+	width, height := c.Image.Cols(), c.Image.Rows()
+
+	sv := &stippleVoronoi{
+		width:   width,
+		height:  height,
+		density: density,
+	}
+	sv.init(opts.Points, rand.New(rand.NewSource(noiseSeed(opts.Seed))))
+	for i := 0; i < opts.Iterations; i++ {
+		sv.relax()
+	}
+	return &Stippling{
+		Width:  width,
+		Height: height,
+		Dots:   sv.dots(opts.MinRadius, opts.MaxRadius),
+	}, nil
+}
+
+// stippleDensity returns the dot density in the [0, 1] range, obtained from the source image darkness
+// increased by the blurred line drawing.
+func (c *Cld) stippleDensity(lineWeight float64) []float64 {
+	tone := c.tone()
+	defer tone.Close()
+
+	lines := c.result.Clone()
+	defer lines.Close()
+	gocv.GaussianBlur(lines, &lines, image.Point{5, 5}, 0, 0, gocv.BorderReplicate)
+
+	width, height := c.Image.Cols(), c.Image.Rows()
+	density := make([]float64, width*height)
+
+	var maxDensity float64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dark := 1.0 - float64(tone.GetUCharAt(y, x))/255.0
+			ink := 1.0 - float64(lines.GetUCharAt(y, x))/255.0
+			d := dark + lineWeight*ink
+			density[y*width+x] = d
+			maxDensity = math.Max(maxDensity, d)
+		}
+	}
+	if maxDensity > 0 {
+		for i := range density {
+			density[i] /= maxDensity
+		}
+	}
+	return density
+}
+
+// stippleVoronoi computes the centroidal Voronoi tessellation of the stipple dots on the pixel grid.
+type stippleVoronoi struct {
+	width, height int
+	density       []float64
+	points        []Point
+	// cellDensity holds the average density of the Voronoi cells after the last relaxation.
+	cellDensity []float64
+}
+
+// init distributes the points by rejection sampling on the density.
+func (sv *stippleVoronoi) init(n int, rnd *rand.Rand) {
+	sv.points = make([]Point, 0, n)
+
+	for attempts := 0; len(sv.points) < n && attempts < n*1000; attempts++ {
+		x, y := rnd.Float64()*float64(sv.width), rnd.Float64()*float64(sv.height)
+		if rnd.Float64() < sv.density[int(y)*sv.width+int(x)] {
+			sv.points = append(sv.points, Point{x, y})
+		}
+	}
+	sv.cellDensity = make([]float64, len(sv.points))
+}
+
+// relax moves each point to the density weighted centroid of its Voronoi cell.
+func (sv *stippleVoronoi) relax() {
+	n := len(sv.points)
+	if n == 0 {
+		return
+	}
+	cellSize := math.Max(1, math.Sqrt(float64(sv.width*sv.height)/float64(n)))
+	grid := newSiteGrid(sv.width, sv.height, cellSize, sv.points)
+
+	sumX := make([]float64, n)
+	sumY := make([]float64, n)
+	sumW := make([]float64, n)
+	area := make([]int, n)
+
+	for y := 0; y < sv.height; y++ {
+		for x := 0; x < sv.width; x++ {
+			p := Point{float64(x) + 0.5, float64(y) + 0.5}
+			i := grid.nearest(p)
+			if i < 0 {
+				continue
+			}
+			w := sv.density[y*sv.width+x]
+
+			sumX[i] += w * p.X
+			sumY[i] += w * p.Y
+			sumW[i] += w
+			area[i]++
+		}
+	}
+
+	for i := range sv.points {
+		if sumW[i] > 0 {
+			sv.points[i] = Point{sumX[i] / sumW[i], sumY[i] / sumW[i]}
+		}
+		if area[i] > 0 {
+			sv.cellDensity[i] = sumW[i] / float64(area[i])
+		}
+	}
+}
+
+// dots returns the stipple dots, their radius depending on the density of their Voronoi cell.
+func (sv *stippleVoronoi) dots(minRadius, maxRadius float64) []Dot {
+	dots := make([]Dot, len(sv.points))
+	for i, p := range sv.points {
+		dots[i] = Dot{
+			X: p.X,
+			Y: p.Y,
+			R: minRadius + (maxRadius-minRadius)*sv.cellDensity[i],
+		}
+	}
+	return dots
+}
+
+// siteGrid is a spatial hash of the Voronoi sites, used for the fast nearest site lookup.
+type siteGrid struct {
+	cellSize   float64
+	cols, rows int
+	cells      [][]int
+	sites      []Point
+}
+
+// newSiteGrid creates a new site grid with the provided cell size.
+func newSiteGrid(width, height int, cellSize float64, sites []Point) *siteGrid {
+	g := &siteGrid{
+		cellSize: cellSize,
+		cols:     int(float64(width)/cellSize) + 1,
+		rows:     int(float64(height)/cellSize) + 1,
+		sites:    sites,
+	}
+	g.cells = make([][]int, g.cols*g.rows)
+	for i, p := range sites {
+		cx, cy := int(p.X/cellSize), int(p.Y/cellSize)
+		g.cells[cy*g.cols+cx] = append(g.cells[cy*g.cols+cx], i)
+	}
+	return g
+}
+
+// nearest returns the index of the site closest to p, searching the grid cells in growing rings.
+// It returns -1 if there are no sites.
+func (g *siteGrid) nearest(p Point) int {
+	cx, cy := int(p.X/g.cellSize), int(p.Y/g.cellSize)
+
+	best, bestDist := -1, math.Inf(1)
+	maxRing := g.cols
+	if g.rows > maxRing {
+		maxRing = g.rows
+	}
+	for ring := 0; ring <= maxRing; ring++ {
+		for y := cy - ring; y <= cy+ring; y++ {
+			for x := cx - ring; x <= cx+ring; x++ {
+				// Visit only the cells on the ring border.
+				if absInt(x-cx) != ring && absInt(y-cy) != ring {
+					continue
+				}
+				if x < 0 || x >= g.cols || y < 0 || y >= g.rows {
+					continue
+				}
+				for _, i := range g.cells[y*g.cols+x] {
+					q := g.sites[i]
+					if d := (p.X-q.X)*(p.X-q.X) + (p.Y-q.Y)*(p.Y-q.Y); d < bestDist {
+						best, bestDist = i, d
+					}
+				}
+			}
+		}
+		// The sites of the next rings are at least ring*cellSize away.
+		if best >= 0 && math.Sqrt(bestDist) <= float64(ring)*g.cellSize {
+			break
+		}
+	}
+	return best
+}
@@ -0,0 +1,112 @@
+package colidr
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestCld_Stipple(t *testing.T) {
+	// A horizontal tone ramp, from black on the left to white on the right.
+	const size = 64
+	c := newTestCld(size, testOptions())
+	c.result.SetTo(gocv.NewScalar(255, 0, 0, 0))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			v := uint8(255 * x / (size - 1))
+			for ch := 0; ch < 3; ch++ {
+				c.source.SetUCharAt(y, x*3+ch, v)
+			}
+		}
+	}
+
+	s, err := c.Stipple(StippleOptions{Points: 400, MinRadius: 0.5, MaxRadius: 2, LineWeight: 0, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Dots) != 400 {
+		t.Fatalf("expected 400 dots, got %d", len(s.Dots))
+	}
+
+	var dark, light int
+	var darkR, lightR float64
+	for _, d := range s.Dots {
+		if d.X < 0 || d.X > size || d.Y < 0 || d.Y > size {
+			t.Fatalf("expected the dots inside the image, got %v", d)
+		}
+		if d.R < 0.5 || d.R > 2 {
+			t.Fatalf("expected the dot radius in the [0.5, 2] range, got %v", d.R)
+		}
+		if d.X < size/2 {
+			dark++
+			darkR += d.R
+		} else {
+			light++
+			lightR += d.R
+		}
+	}
+	if dark <= 2*light {
+		t.Errorf("expected the dots to be denser in the dark half, got %d dark and %d light dots", dark, light)
+	}
+	if light > 0 && darkR/float64(dark) <= lightR/float64(light) {
+		t.Errorf("expected larger dots in the dark half, got %v and %v", darkR/float64(dark), lightR/float64(light))
+	}
+}
+
+func TestCld_StippleDefaultSeed(t *testing.T) {
+	c := newTestCld(32, testOptions())
+	c.result.SetTo(gocv.NewScalar(255, 0, 0, 0))
+	c.source.SetTo(gocv.NewScalar(100, 100, 100, 0))
+
+	stipple := func() []Dot {
+		s, err := c.Stipple(StippleOptions{Points: 50})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.Dots
+	}
+	a, b := stipple(), stipple()
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("expected the default seed to produce the same dots, got %v and %v", a[i], b[i])
+		}
+	}
+}
+
+func TestStippling_EncodeSVG(t *testing.T) {
+	s := &Stippling{
+		Width:  10,
+		Height: 8,
+		Dots:   []Dot{{X: 1, Y: 2, R: 0.5}, {X: 5.25, Y: 6, R: 1.5}},
+	}
+	var buf bytes.Buffer
+	if err := s.EncodeSVG(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var svg struct {
+		Width   int `xml:"width,attr"`
+		Height  int `xml:"height,attr"`
+		Circles []struct {
+			CX float64 `xml:"cx,attr"`
+			CY float64 `xml:"cy,attr"`
+			R  float64 `xml:"r,attr"`
+		} `xml:"g>circle"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &svg); err != nil {
+		t.Fatalf("expected a valid SVG document: %v", err)
+	}
+	if svg.Width != 10 || svg.Height != 8 {
+		t.Errorf("expected a 10x8 SVG document, got %dx%d", svg.Width, svg.Height)
+	}
+	if len(svg.Circles) != len(s.Dots) {
+		t.Fatalf("expected a circle for each of the %d dots, got %d", len(s.Dots), len(svg.Circles))
+	}
+	for i, d := range s.Dots {
+		if c := svg.Circles[i]; c.CX != d.X || c.CY != d.Y || c.R != d.R {
+			t.Errorf("expected the circle %v, got %v", d, c)
+		}
+	}
+}
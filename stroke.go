@@ -0,0 +1,89 @@
+package colidr
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// strokes applies the stroke weight related post processing operations on the binary result:
+// line length filtering, pressure-like tapering and morphological thinning or thickening.
+func (c *Cld) strokes() {
+	if c.MinLineLength > 0 {
+		c.filterShortLines(c.MinLineLength)
+	}
+	if c.TaperWidth > 0 {
+		c.taper(c.TaperWidth)
+	}
+	if c.StrokeWeight != 0 {
+		c.adjustStrokeWeight(c.StrokeWeight)
+	}
+}
+
+// adjustStrokeWeight thickens the lines in case of a positive weight and thins them in case of a negative one.
+// Because the lines are black on white background, thickening is done by erosion and thinning by dilation.
+func (c *Cld) adjustStrokeWeight(weight int) {
+	ksize := 2*absInt(weight) + 1
+	kernel := gocv.GetStructuringElement(gocv.MorphEllipse, image.Point{ksize, ksize})
+	defer kernel.Close()
+
+	if weight > 0 {
+		gocv.Erode(c.result, &c.result, kernel)
+	} else {
+		gocv.Dilate(c.result, &c.result, kernel)
+	}
+}
+
+// taper varies the line width in function of the gradient magnitude, resembling the pen pressure.
+// Each ink pixel is stamped along the gradient direction (the normal of the flow)
+// with a width proportional to the local gradient magnitude.
+func (c *Cld) taper(maxWidth float64) {
+	width, height := c.result.Cols(), c.result.Rows()
+
+	src := c.result.ToBytes()
+	dst := c.result.DataPtrUint8()
+	flow, _ := c.etf.flowField.DataPtrFloat32()
+	mag, _ := c.etf.gradientMag.DataPtrFloat32()
+
+	// The stamps of the neighbouring pixels overlap, so the pixels are processed sequentially.
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			idx := y*width + x
+			if src[idx] != 0 {
+				continue
+			}
+			normal := position{x: float64(-flow[3*idx]), y: float64(flow[3*idx+1])}
+			magnitude := (mag[3*idx] + mag[3*idx+1] + mag[3*idx+2]) / 3.0
+			radius := maxWidth * float64(magnitude) / 2.0
+
+			for t := -radius; t <= radius; t++ {
+				col := int(math.Round(float64(x) + normal.x*t))
+				row := int(math.Round(float64(y) + normal.y*t))
+
+				if row < 0 || row > height-1 || col < 0 || col > width-1 {
+					continue
+				}
+				dst[row*width+col] = 0
+			}
+		}
+	}
+}
+
+// filterShortLines removes the lines having a length smaller than the provided minimum length.
+// The length of a line is approximated by the half of its contour perimeter.
+func (c *Cld) filterShortLines(minLength int) {
+	ink := gocv.NewMat()
+	defer ink.Close()
+	gocv.BitwiseNot(c.result, &ink)
+
+	contours := gocv.FindContours(ink, gocv.RetrievalExternal, gocv.ChainApproxNone)
+	white := color.RGBA{255, 255, 255, 255}
+
+	for i, contour := range contours {
+		if gocv.ArcLength(contour, false)/2.0 < float64(minLength) {
+			gocv.DrawContours(&c.result, contours, i, white, -1)
+		}
+	}
+}
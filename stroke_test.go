@@ -0,0 +1,71 @@
+package colidr
+
+import (
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// inkWidth returns the number of ink pixels of the result row.
+func inkWidth(c *Cld, row int) int {
+	var n int
+	for x := 0; x < c.result.Cols(); x++ {
+		if c.result.GetUCharAt(row, x) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// inkRect fills the result rectangle between the provided corners, inclusive, with ink.
+func inkRect(c *Cld, x0, y0, x1, y1 int) {
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			c.result.SetUCharAt(y, x, 0)
+		}
+	}
+}
+
+func TestCld_AdjustStrokeWeight(t *testing.T) {
+	for weight, expected := range map[int]int{1: 5, 2: 7, -1: 1} {
+		c := newTestCld(32, testOptions())
+		c.result.SetTo(gocv.NewScalar(255, 0, 0, 0))
+		inkRect(c, 15, 4, 17, 27)
+
+		c.adjustStrokeWeight(weight)
+		if w := inkWidth(c, 16); w != expected {
+			t.Errorf("stroke weight %d: expected a line width of %d, got %d", weight, expected, w)
+		}
+	}
+}
+
+func TestCld_Taper(t *testing.T) {
+	// The uniform flow is vertical, so the ink pixels are stamped horizontally.
+	c := newTestCld(32, testOptions())
+	c.etf = newUniformEtf(32, gocv.Vecf{1, 0, 0}, 1)
+	c.result.SetTo(gocv.NewScalar(255, 0, 0, 0))
+	c.result.SetUCharAt(16, 16, 0)
+
+	c.taper(4)
+	if w := inkWidth(c, 16); w != 5 {
+		t.Errorf("expected a tapered width of 5 for the maximum gradient magnitude, got %d", w)
+	}
+	if w := inkWidth(c, 15); w != 0 {
+		t.Errorf("expected the stamp to follow the flow normal, got %d ink pixels on the neighbouring row", w)
+	}
+}
+
+func TestCld_FilterShortLines(t *testing.T) {
+	c := newTestCld(32, testOptions())
+	c.result.SetTo(gocv.NewScalar(255, 0, 0, 0))
+	inkRect(c, 4, 4, 24, 4)
+	inkRect(c, 4, 20, 6, 20)
+
+	c.filterShortLines(10)
+	if w := inkWidth(c, 4); w != 21 {
+		t.Errorf("expected the long line to be kept, got %d ink pixels", w)
+	}
+	if w := inkWidth(c, 20); w != 0 {
+		t.Errorf("expected the short line to be removed, got %d ink pixels", w)
+	}
+}
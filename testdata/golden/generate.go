@@ -0,0 +1,383 @@
+//go:build ignore
+// +build ignore
+
+// generate writes the golden images compared by TestCld_Golden, running the coherent line drawing pipeline
+// on the grayscale fixtures without OpenCV. The OpenCV stages used by the pipeline, the 5x5 Sobel operator,
+// the min-max normalization and the 3x3 gaussian blur, are ported to Go, while the other stages follow
+// the package implementation. When OpenCV is available the images can be regenerated by the test itself:
+//
+//	go test -mod=vendor -run TestCld_Golden -update
+//
+// Otherwise run it from the repository root:
+//
+//	go run testdata/golden/generate.go
+package main
+
+import (
+	"image"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// options mirrors the testOptions of the test suite.
+type options struct {
+	sigmaR, sigmaM, sigmaC, rho float64
+	tau                         float32
+	etfKernel, etfIteration     int
+	fDogIteration               int
+}
+
+func defaultOptions() options {
+	return options{
+		sigmaR:       2.6,
+		sigmaM:       3.0,
+		sigmaC:       1.0,
+		rho:          0.98,
+		tau:          0.98,
+		etfKernel:    3,
+		etfIteration: 1,
+	}
+}
+
+func main() {
+	tests := []struct {
+		name    string
+		fixture string
+		opts    func(*options)
+	}{
+		{"circle_default", "circle", func(*options) {}},
+		{"circle_fdog_iteration", "circle", func(o *options) { o.fDogIteration = 1 }},
+		{"stripes_default", "stripes", func(*options) {}},
+		{"stripes_kernel", "stripes", func(o *options) { o.etfKernel = 5; o.etfIteration = 2 }},
+	}
+
+	for _, tt := range tests {
+		opts := defaultOptions()
+		tt.opts(&opts)
+
+		src, err := loadGray(filepath.Join("testdata", tt.fixture+".png"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		res := generate(src, opts)
+
+		f, err := os.Create(filepath.Join("testdata", "golden", tt.name+".png"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := png.Encode(f, res); err != nil {
+			log.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// loadGray decodes the grayscale fixture.
+func loadGray(file string) (*image.Gray, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	gray := image.NewGray(img.Bounds())
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			gray.Set(x, y, img.At(x, y))
+		}
+	}
+	return gray, nil
+}
+
+// generate returns the line drawing of the grayscale image, like Cld.GenerateCld.
+func generate(src *image.Gray, opts options) *image.Gray {
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	flow := edgeTangentFlow(src.Pix, width, height, opts)
+
+	gray := append([]uint8{}, src.Pix...)
+	result := make([]uint8, len(gray))
+
+	for i := 0; i <= opts.fDogIteration; i++ {
+		if i > 0 {
+			for j, v := range result {
+				if v == 0 {
+					gray[j] = 0
+				}
+			}
+			gray = gaussianBlur3(gray, width, height)
+		}
+		img := make([]float32, len(gray))
+		for j, v := range gray {
+			img[j] = float32(v) * float32(1.0/255.0)
+		}
+		dog := gradientDoG(img, flow, width, height, opts)
+		fDog := integrateFlow(dog, flow, width, height, opts.sigmaM)
+		normalize(fDog)
+
+		for j, v := range fDog {
+			result[j] = 255
+			if v < opts.tau {
+				result[j] = 0
+			}
+		}
+	}
+	return &image.Gray{Pix: result, Stride: width, Rect: image.Rect(0, 0, width, height)}
+}
+
+// edgeTangentFlow computes and refines the edge tangent flow, like Etf.InitFromMat and Etf.RefineEtf.
+// Since the image is grayscale, the three color channels of the package are the same.
+func edgeTangentFlow(pix []uint8, width, height int, opts options) []float32 {
+	src := make([]float32, len(pix))
+	for i, v := range pix {
+		src[i] = 255 * float32(v)
+	}
+	normalize(src)
+
+	gradX := sobel5(src, width, height, []float64{-1, -2, 0, 2, 1}, []float64{1, 4, 6, 4, 1})
+	gradY := sobel5(src, width, height, []float64{1, 4, 6, 4, 1}, []float64{-1, -2, 0, 2, 1})
+
+	// The gradient, stored as (y, x), is rotated by 90 degrees like Etf.rotateFlow does.
+	cos, sin := math.Cos(math.Pi/2), math.Sin(math.Pi/2)
+	mag := make([]float32, len(src))
+	flow := make([]float32, 3*len(src))
+	for i := range src {
+		mag[i] = float32(math.Sqrt(float64(gradX[i]*gradX[i] + gradY[i]*gradY[i])))
+		gy, gx := float64(gradY[i]), float64(gradX[i])
+		flow[3*i], flow[3*i+1] = float32(gy*cos-gx*sin), float32(gy*sin+gx*cos)
+	}
+	normalize(mag)
+
+	offsets := circleOffsets(opts.etfKernel)
+	for i := 0; i < opts.etfIteration; i++ {
+		flow = refine(flow, mag, width, height, offsets)
+	}
+	return flow
+}
+
+// sobel5 applies the separable 5x5 kernel, the first vector along the rows and the second along the columns,
+// reflecting the image at the borders like the default OpenCV border mode.
+func sobel5(src []float32, width, height int, kx, ky []float64) []float32 {
+	dst := make([]float32, len(src))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum float64
+			for j := -2; j <= 2; j++ {
+				r := reflect101(y+j, height)
+				for i := -2; i <= 2; i++ {
+					c := reflect101(x+i, width)
+					sum += ky[j+2] * kx[i+2] * float64(src[r*width+c])
+				}
+			}
+			dst[y*width+x] = float32(sum)
+		}
+	}
+	return dst
+}
+
+// reflect101 maps the coordinate into the [0, n) range, reflecting it around the border pixels.
+func reflect101(i, n int) int {
+	if i < 0 {
+		return -i
+	}
+	if i >= n {
+		return 2*n - 2 - i
+	}
+	return i
+}
+
+// normalize maps the values linearly into the [0, 1] range, like the OpenCV min-max normalization.
+func normalize(values []float32) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		lo, hi = math.Min(lo, float64(v)), math.Max(hi, float64(v))
+	}
+	var scale float64
+	if hi > lo {
+		scale = 1 / (hi - lo)
+	}
+	for i, v := range values {
+		values[i] = float32(float64(v)*scale - lo*scale)
+	}
+}
+
+// gaussianBlur3 applies the 3x3 gaussian blur having the [1 2 1] / 4 kernel, padding the image with black pixels.
+func gaussianBlur3(src []uint8, width, height int) []uint8 {
+	kernel := []int{1, 2, 1}
+	at := func(x, y int) int {
+		if x < 0 || x >= width || y < 0 || y >= height {
+			return 0
+		}
+		return int(src[y*width+x])
+	}
+	dst := make([]uint8, len(src))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum int
+			for j := -1; j <= 1; j++ {
+				for i := -1; i <= 1; i++ {
+					sum += kernel[j+1] * kernel[i+1] * at(x+i, y+j)
+				}
+			}
+			dst[y*width+x] = uint8((sum + 8) >> 4)
+		}
+	}
+	return dst
+}
+
+type point struct {
+	x, y int
+}
+
+// circleOffsets returns the offsets of the neighbours closer than the kernel radius.
+func circleOffsets(kernel int) []point {
+	var offsets []point
+	for dy := -kernel; dy <= kernel; dy++ {
+		for dx := -kernel; dx <= kernel; dx++ {
+			if dx*dx+dy*dy < kernel*kernel {
+				offsets = append(offsets, point{dx, dy})
+			}
+		}
+	}
+	return offsets
+}
+
+// refine computes the refined edge tangent flow following the paper's Eq(1).
+func refine(flow, mag []float32, width, height int, offsets []point) []float32 {
+	dst := make([]float32, len(flow))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			idx := y*width + x
+			t0, t1, t2 := flow[3*idx], flow[3*idx+1], flow[3*idx+2]
+
+			var n0, n1, n2 float32
+			for _, o := range offsets {
+				r, c := y+o.y, x+o.x
+				if r < 0 || r >= height || c < 0 || c >= width {
+					continue
+				}
+				i := r*width + c
+				u0, u1, u2 := flow[3*i], flow[3*i+1], flow[3*i+2]
+				wm := float32((1 + math.Tanh(float64(mag[idx]-mag[i]))) / 2)
+				w := (t0*u0 + t1*u1 + t2*u2) * wm
+				n0 += u0 * w
+				n1 += u1 * w
+				n2 += u2 * w
+			}
+			norm := float32(math.Sqrt(float64(n0*n0) + float64(n1*n1) + float64(n2*n2)))
+			if norm > 0 {
+				dst[3*idx], dst[3*idx+1], dst[3*idx+2] = n0/norm, n1/norm, n2/norm
+			}
+		}
+	}
+	return dst
+}
+
+// gaussianVector returns the gaussian weights for the 0, 1, ... distances, up to the first one below 0.001.
+func gaussianVector(sigma float64) []float64 {
+	gauss := func(x float64) float64 {
+		return math.Exp(-x*x/(2*sigma*sigma)) / math.Sqrt(math.Pi*2.0*sigma*sigma)
+	}
+	i := 1
+	for gauss(float64(i)) >= 0.001 {
+		i++
+	}
+	v := make([]float64, i+1)
+	for j := range v {
+		v[j] = gauss(float64(j))
+	}
+	return v
+}
+
+// gradientDoG computes the difference of gaussians along the gradient direction, like Cld.gradientDoG.
+func gradientDoG(src, flow []float32, width, height int, opts options) []float32 {
+	gvc := gaussianVector(opts.sigmaC)
+	gvs := gaussianVector(opts.sigmaR * opts.sigmaC)
+	kernel := len(gvs) - 1
+
+	dst := make([]float32, len(src))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			idx := y*width + x
+			gx, gy := float64(-flow[3*idx]), float64(flow[3*idx+1])
+
+			var cAcc, sAcc, cWeight, sWeight float64
+			for step := -kernel; step <= kernel; step++ {
+				row := float64(y) + gy*float64(step)
+				col := float64(x) + gx*float64(step)
+				if row > float64(height-1) || row < 0 || col > float64(width-1) || col < 0 {
+					continue
+				}
+				val := float64(src[int(math.Round(row))*width+int(math.Round(col))])
+
+				k := step
+				if k < 0 {
+					k = -k
+				}
+				var wc float64
+				if k < len(gvc) {
+					wc = gvc[k]
+				}
+				cAcc += val * wc
+				sAcc += val * gvs[k]
+				cWeight += wc
+				sWeight += gvs[k]
+			}
+			dst[idx] = float32(cAcc/cWeight - opts.rho*sAcc/sWeight)
+		}
+	}
+	return dst
+}
+
+// integrateFlow integrates the gradient DoG along the edge tangent flow, like Cld.integrateFlow.
+func integrateFlow(src, flow []float32, width, height int, sigmaM float64) []float32 {
+	gv := gaussianVector(sigmaM)
+	kernelHalf := len(gv) - 1
+
+	dst := make([]float32, len(src))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			idx := y*width + x
+			acc := -gv[0] * float64(src[idx])
+			weightAcc := -gv[0]
+
+			for _, sign := range []float32{1, -1} {
+				px, py := float64(x), float64(y)
+				for step := 0; step < kernelHalf; step++ {
+					i := int(py)*width + int(px)
+					dx, dy := float64(sign*flow[3*i+1]), float64(sign*flow[3*i])
+					if dx == 0 && dy == 0 {
+						break
+					}
+					if px > float64(width-1) || px < 0 || py > float64(height-1) || py < 0 {
+						break
+					}
+					acc += float64(src[i]) * gv[step]
+					weightAcc += gv[step]
+
+					px += dx
+					py += dy
+					if int(math.Round(px)) < 0 || int(math.Round(px)) > width-1 ||
+						int(math.Round(py)) < 0 || int(math.Round(py)) > height-1 {
+						break
+					}
+				}
+			}
+
+			res := 1.0
+			if v := acc / weightAcc; v <= 0 {
+				res = 1 + math.Tanh(v)
+			}
+			dst[idx] = float32(res)
+		}
+	}
+	return dst
+}
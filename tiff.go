@@ -0,0 +1,322 @@
+package colidr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// The supported TIFF compression schemes.
+const (
+	TIFFUncompressed = "none"
+	TIFFLZW          = "lzw"
+)
+
+// TIFF tags, data types and values used by the encoder.
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffPhotometric     = 262
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffExtraSamples    = 338
+	tiffSampleFormat    = 339
+
+	tiffShort = 3
+	tiffLong  = 4
+
+	tiffPhotometricBlackIsZero = 1
+	tiffPhotometricRGB         = 2
+	tiffExtraSampleUnassoc     = 2
+	tiffSampleFormatFloat      = 3
+)
+
+// TIFFOptions contains the options of the TIFF encoder.
+type TIFFOptions struct {
+	// Compression is either none or lzw. Defaults to lzw.
+	Compression string
+}
+
+// EncodeTIFF writes the image in TIFF format. The bilevel images (containing only black and white pixels)
+// are packed as 1-bit images, the grayscale images as 8-bit images and the rest as 8-bit RGBA images.
+func EncodeTIFF(w io.Writer, img image.Image, opts *TIFFOptions) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+
+	var (
+		pix     []byte
+		bits    []uint32
+		photo   uint32 = tiffPhotometricBlackIsZero
+		samples        = 1
+	)
+	switch {
+	case isBilevel(img):
+		pix, bits = packBits(img), []uint32{1}
+	case isGray(img):
+		pix, bits = make([]byte, 0, width*height), []uint32{8}
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				pix = append(pix, color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+			}
+		}
+	default:
+		pix, bits = make([]byte, 0, width*height*4), []uint32{8, 8, 8, 8}
+		photo, samples = tiffPhotometricRGB, 4
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				pix = append(pix, c.R, c.G, c.B, c.A)
+			}
+		}
+	}
+
+	ifd := []tiffEntry{
+		{tiffImageWidth, tiffLong, []uint32{uint32(width)}},
+		{tiffImageLength, tiffLong, []uint32{uint32(height)}},
+		{tiffBitsPerSample, tiffShort, bits},
+		{tiffPhotometric, tiffShort, []uint32{photo}},
+		{tiffSamplesPerPixel, tiffShort, []uint32{uint32(samples)}},
+	}
+	if samples == 4 {
+		ifd = append(ifd, tiffEntry{tiffExtraSamples, tiffShort, []uint32{tiffExtraSampleUnassoc}})
+	}
+	return writeTIFF(w, width, height, pix, ifd, opts)
+}
+
+// EncodeTIFF writes the float image as a 32-bit floating point grayscale TIFF.
+func (f *FloatImage) EncodeTIFF(w io.Writer, opts *TIFFOptions) error {
+	pix := make([]byte, 4*len(f.Pix))
+	for i, v := range f.Pix {
+		binary.LittleEndian.PutUint32(pix[4*i:], math.Float32bits(v))
+	}
+	ifd := []tiffEntry{
+		{tiffImageWidth, tiffLong, []uint32{uint32(f.Width)}},
+		{tiffImageLength, tiffLong, []uint32{uint32(f.Height)}},
+		{tiffBitsPerSample, tiffShort, []uint32{32}},
+		{tiffPhotometric, tiffShort, []uint32{tiffPhotometricBlackIsZero}},
+		{tiffSamplesPerPixel, tiffShort, []uint32{1}},
+		{tiffSampleFormat, tiffShort, []uint32{tiffSampleFormatFloat}},
+	}
+	return writeTIFF(w, f.Width, f.Height, pix, ifd, opts)
+}
+
+// tiffEntry is an IFD entry.
+type tiffEntry struct {
+	tag      uint16
+	datatype uint16
+	values   []uint32
+}
+
+// writeTIFF writes a little endian TIFF file, storing the pixel data in a single strip.
+// The image size, sample and photometric related entries are provided by the caller.
+func writeTIFF(w io.Writer, width, height int, pix []byte, ifd []tiffEntry, opts *TIFFOptions) error {
+	compression := TIFFLZW
+	if opts != nil && opts.Compression != "" {
+		compression = opts.Compression
+	}
+	var scheme uint32
+	switch compression {
+	case TIFFUncompressed:
+		scheme = 1
+	case TIFFLZW:
+		scheme = 5
+		pix = lzwCompress(pix)
+	default:
+		return fmt.Errorf("unsupported TIFF compression: %v", compression)
+	}
+
+	const headerLen = 8
+	// The pixel data is followed by the IFD, padded to word boundary.
+	ifdOffset := headerLen + len(pix) + len(pix)%2
+
+	ifd = append(ifd,
+		tiffEntry{tiffCompression, tiffShort, []uint32{scheme}},
+		tiffEntry{tiffStripOffsets, tiffLong, []uint32{headerLen}},
+		tiffEntry{tiffRowsPerStrip, tiffLong, []uint32{uint32(height)}},
+		tiffEntry{tiffStripByteCounts, tiffLong, []uint32{uint32(len(pix))}},
+	)
+	// The IFD entries should be sorted in ascending order by tag.
+	for i := 1; i < len(ifd); i++ {
+		for j := i; j > 0 && ifd[j].tag < ifd[j-1].tag; j-- {
+			ifd[j], ifd[j-1] = ifd[j-1], ifd[j]
+		}
+	}
+
+	buf := bufio.NewWriter(w)
+	le := binary.LittleEndian
+
+	buf.WriteString("II")
+	binary.Write(buf, le, uint16(42))
+	binary.Write(buf, le, uint32(ifdOffset))
+	buf.Write(pix)
+	if len(pix)%2 == 1 {
+		buf.WriteByte(0)
+	}
+
+	// The values which don't fit into the 4 bytes of the entry are stored after the IFD.
+	var extra bytes.Buffer
+	extraOffset := ifdOffset + 2 + 12*len(ifd) + 4
+
+	binary.Write(buf, le, uint16(len(ifd)))
+	for _, e := range ifd {
+		binary.Write(buf, le, e.tag)
+		binary.Write(buf, le, e.datatype)
+		binary.Write(buf, le, uint32(len(e.values)))
+
+		var data [4]byte
+		size := 2
+		if e.datatype == tiffLong {
+			size = 4
+		}
+		if len(e.values)*size <= 4 {
+			for i, v := range e.values {
+				if size == 2 {
+					le.PutUint16(data[2*i:], uint16(v))
+				} else {
+					le.PutUint32(data[:], v)
+				}
+			}
+		} else {
+			le.PutUint32(data[:], uint32(extraOffset+extra.Len()))
+			for _, v := range e.values {
+				if size == 2 {
+					binary.Write(&extra, le, uint16(v))
+				} else {
+					binary.Write(&extra, le, v)
+				}
+			}
+		}
+		buf.Write(data[:])
+	}
+	// There is no next IFD.
+	binary.Write(buf, le, uint32(0))
+	buf.Write(extra.Bytes())
+
+	return buf.Flush()
+}
+
+// lzwCompress compresses the data using the TIFF flavour of the LZW algorithm:
+// the codes are packed starting with the most significant bit and the code width
+// is increased one code earlier than in the GIF flavour.
+func lzwCompress(data []byte) []byte {
+	const (
+		clearCode = 256
+		eoiCode   = 257
+		maxCode   = 4094
+	)
+	var (
+		out   bytes.Buffer
+		acc   uint32
+		nbits uint
+		width uint = 9
+	)
+	emit := func(code int) {
+		acc = acc<<width | uint32(code)
+		nbits += width
+		for nbits >= 8 {
+			out.WriteByte(byte(acc >> (nbits - 8)))
+			nbits -= 8
+		}
+	}
+
+	// The dictionary maps the prefix code and the next byte to the code of the extended string.
+	table := make(map[uint32]int)
+	next := eoiCode + 1
+	emit(clearCode)
+
+	prefix := -1
+	for _, c := range data {
+		if prefix < 0 {
+			prefix = int(c)
+			continue
+		}
+		key := uint32(prefix)<<8 | uint32(c)
+		if code, ok := table[key]; ok {
+			prefix = code
+			continue
+		}
+		emit(prefix)
+		table[key] = next
+		next++
+		if next >= 1<<width && width < 12 {
+			width++
+		}
+		if next >= maxCode {
+			emit(clearCode)
+			table = make(map[uint32]int)
+			next = eoiCode + 1
+			width = 9
+		}
+		prefix = int(c)
+	}
+	if prefix >= 0 {
+		emit(prefix)
+		next++
+		if next >= 1<<width && width < 12 {
+			width++
+		}
+	}
+	emit(eoiCode)
+	if nbits > 0 {
+		out.WriteByte(byte(acc << (8 - nbits)))
+	}
+	return out.Bytes()
+}
+
+// isBilevel checks if the image contains only black and white pixels.
+func isBilevel(img image.Image) bool {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			if a != 0xffff || r != g || g != bl || (r != 0 && r != 0xffff) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isGray checks if the image is an opaque grayscale image.
+func isGray(img image.Image) bool {
+	if _, ok := img.(*image.Gray); ok {
+		return true
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			if a != 0xffff || r != g || g != bl {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// packBits packs the image into 1 bit per pixel rows, padded to byte boundary,
+// the white pixels being stored as 1 bits. The pixels darker than the middle gray are considered black.
+func packBits(img image.Image) []byte {
+	b := img.Bounds()
+	stride := (b.Dx() + 7) / 8
+	pix := make([]byte, stride*b.Dy())
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y >= 128 {
+				i, j := y-b.Min.Y, x-b.Min.X
+				pix[i*stride+j/8] |= 0x80 >> uint(j%8)
+			}
+		}
+	}
+	return pix
+}
@@ -0,0 +1,789 @@
+package colidr
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+
+	"gocv.io/x/gocv"
+)
+
+// tileBytesPerPixel is the estimated memory needed to process a tile pixel. The matrices of the ETF stage,
+// the most demanding one, take around 120 bytes per pixel, the rest covers the temporary copies.
+const tileBytesPerPixel = 256
+
+// sobelMargin is the margin needed by the 5x5 Sobel operator.
+const sobelMargin = 2
+
+// TileOptions contains the options of the memory-bounded tiled processing.
+type TileOptions struct {
+	// MemoryBudget is the approximate memory in bytes of the tiled processing. It includes the decoding
+	// of the source image, which is loaded entirely into memory before being split into tiles and takes
+	// the file size plus 9 to 16 bytes per pixel, depending on the format: the rest is left to the tiles.
+	MemoryBudget int64
+	// TileSize overrides the tile size derived from the memory budget.
+	TileSize int
+	// TempDir is the directory of the temporary files holding the intermediate results.
+	// If it's empty the default temporary directory is used.
+	TempDir string
+}
+
+// TiledResult is the line drawing produced by the tiled processing, stored in a temporary file.
+// It should be closed once it's not needed anymore.
+type TiledResult struct {
+	Width  int
+	Height int
+	result *raster
+}
+
+// Image loads the line drawing into memory.
+func (r *TiledResult) Image() (*image.Gray, error) {
+	data, err := r.result.read(image.Rect(0, 0, r.Width, r.Height))
+	if err != nil {
+		return nil, err
+	}
+	return &image.Gray{Pix: data, Stride: r.Width, Rect: image.Rect(0, 0, r.Width, r.Height)}, nil
+}
+
+// EncodePGM writes the line drawing in binary 8-bit PGM (P5) format, streaming it row by row from the disk.
+func (r *TiledResult) EncodePGM(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "P5\n%d %d\n255\n", r.Width, r.Height)
+
+	for y := 0; y < r.Height; y++ {
+		row, err := r.result.read(image.Rect(0, y, r.Width, y+1))
+		if err != nil {
+			return err
+		}
+		if _, err := buf.Write(row); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+// Close removes the temporary file holding the line drawing.
+func (r *TiledResult) Close() error {
+	return r.result.close()
+}
+
+// GenerateTiled generates the coherent line drawing of an arbitrarily large image tile by tile,
+// keeping the memory used by the processing of a tile under the budget provided in the tile options.
+// The intermediate results are stored in temporary files. Each tile is processed together with an overlap margin
+// sized from the gaussian kernel lengths and the ETF kernel, while the normalization ranges are computed
+// over the whole image, so that the tiles are joined without seams.
+// Only the decoding of the source image needs it entirely in memory, which is accounted for in the budget. The options requiring the whole image
+// at once, like the automatic Tau selection or the connected component filtering, are not supported.
+func GenerateTiled(imgFile string, opts Options, tileOpts TileOptions) (*TiledResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.validateTiled(); err != nil {
+		return nil, err
+	}
+	t, err := newTiler(imgFile, opts, tileOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer t.close()
+
+	if err := t.load(imgFile); err != nil {
+		return nil, err
+	}
+	return t.run()
+}
+
+// validateTiled checks that the options don't require the whole image at once.
+func (opts Options) validateTiled() error {
+	var errs ValidationError
+
+	unsupported := func(field string, value interface{}) {
+		errs = append(errs, FieldError{field, value, "is not supported by the tiled processing"})
+	}
+	if opts.AutoTau != "" {
+		unsupported("AutoTau", opts.AutoTau)
+	}
+	if opts.HysteresisTau > 0 {
+		unsupported("HysteresisTau", opts.HysteresisTau)
+	}
+	if opts.MaskFile != "" {
+		unsupported("MaskFile", opts.MaskFile)
+	}
+	if !opts.ROI.Empty() {
+		unsupported("ROI", opts.ROI)
+	}
+	for field, pm := range map[string]ParamMap{"TauMap": opts.TauMap, "SigmaMMap": opts.SigmaMMap, "SigmaCMap": opts.SigmaCMap} {
+		if pm.File != "" {
+			unsupported(field, pm.File)
+		}
+	}
+	if opts.MinLineLength > 0 {
+		unsupported("MinLineLength", opts.MinLineLength)
+	}
+	if opts.MinComponentArea > 0 {
+		unsupported("MinComponentArea", opts.MinComponentArea)
+	}
+	if opts.MinElongation > 0 {
+		unsupported("MinElongation", opts.MinElongation)
+	}
+	if opts.BridgeGap > 0 {
+		unsupported("BridgeGap", opts.BridgeGap)
+	}
+	if opts.VisEtf || opts.VisResult {
+		unsupported("VisEtf", opts.VisEtf || opts.VisResult)
+	}
+	if opts.paperEnabled() {
+		unsupported("Paper", true)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// tileMargins holds the overlap margins needed by the tiled processing stages.
+type tileMargins struct {
+	etf       int
+	fDog      int
+	combine   int
+	post      int
+	antiAlias int
+}
+
+// max returns the largest margin.
+func (m tileMargins) max() int {
+	res := m.etf
+	for _, v := range []int{m.fDog, m.combine, m.post, m.antiAlias} {
+		if v > res {
+			res = v
+		}
+	}
+	return res
+}
+
+// tileMargins returns the overlap margins needed for computing the pixels of a tile
+// as if the whole image were processed at once.
+func (opts Options) tileMargins() tileMargins {
+	dogKernel := len(gauCache.get(opts.SigmaR*opts.SigmaC)) - 1
+	flowKernel := len(gauCache.get(opts.SigmaM)) - 1
+
+	m := tileMargins{
+		// The refinement spreads the flow by the kernel size at each iteration.
+		etf: sobelMargin + opts.EtfIteration*opts.EtfKernel,
+		// The flow integration walks up to the kernel length, sampling the gradient DoG on its way.
+		fDog:    flowKernel + dogKernel + 1,
+		combine: opts.BlurSize / 2,
+	}
+	if opts.TaperWidth > 0 {
+		m.post += int(math.Ceil(opts.TaperWidth/2.0)) + 1
+	}
+	m.post += absInt(opts.StrokeWeight)
+	if opts.AntiAlias {
+		m.antiAlias = opts.BlurSize / 2
+	}
+	return m
+}
+
+// tiler runs the CLD stages tile by tile, keeping the intermediate results in temporary rasters.
+type tiler struct {
+	opts     Options
+	dir      string
+	bounds   image.Rectangle
+	tileSize int
+	margins  tileMargins
+	norm     etfNorm
+
+	source *raster // BGR source image
+	gray   *raster // grayscale image, darkened by the FDoG iterations
+	flow   *raster // edge tangent flow
+	mag    *raster // gradient magnitude, needed by the tapering
+	fDog   *raster // flow DoG, before being normalized
+	result *raster
+}
+
+// newTiler returns a tiler having the tile size either provided in the tile options
+// or derived from the memory budget left once the image file is decoded.
+func newTiler(imgFile string, opts Options, tileOpts TileOptions) (*tiler, error) {
+	margins := opts.tileMargins()
+	tileSize := tileOpts.TileSize
+
+	if tileSize <= 0 {
+		if tileOpts.MemoryBudget <= 0 {
+			return nil, fmt.Errorf("either the memory budget or the tile size should be provided")
+		}
+		peak, err := loadPeak(imgFile)
+		if err != nil {
+			return nil, err
+		}
+		budget := tileOpts.MemoryBudget - peak
+		if budget <= 0 {
+			return nil, fmt.Errorf("the memory budget is too small for decoding the image, which needs %d bytes", peak)
+		}
+		tileSize = int(math.Sqrt(float64(budget)/tileBytesPerPixel)) - 2*margins.max()
+		if tileSize < 1 {
+			return nil, fmt.Errorf("the memory budget is too small for the %d pixels tile margins", margins.max())
+		}
+	}
+	return &tiler{
+		opts:     opts,
+		dir:      tileOpts.TempDir,
+		tileSize: tileSize,
+		margins:  margins,
+	}, nil
+}
+
+// loadPeak estimates the peak memory in bytes used by LoadImage to decode the image file,
+// which holds at once the file content, the decoded image and its flattened and oriented copies.
+func loadPeak(imgFile string) (int64, error) {
+	f, err := os.Open(imgFile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, fmt.Errorf("unable to decode the image %s: %v", imgFile, err)
+	}
+	pixels := int64(cfg.Width) * int64(cfg.Height)
+	return info.Size() + pixels*(decodedBytesPerPixel(cfg.ColorModel)+2*4), nil
+}
+
+// decodedBytesPerPixel returns the bytes per pixel of the images decoded with the color model.
+func decodedBytesPerPixel(model color.Model) int64 {
+	if _, ok := model.(color.Palette); ok {
+		return 1
+	}
+	switch model {
+	case color.GrayModel:
+		return 1
+	case color.Gray16Model:
+		return 2
+	case color.YCbCrModel:
+		// The worst case is the 4:4:4 chroma subsampling.
+		return 3
+	case color.RGBA64Model, color.NRGBA64Model:
+		return 8
+	default:
+		return 4
+	}
+}
+
+// load decodes the source image and stores it in BGR order into the source raster,
+// computing its value range at the same time.
+func (t *tiler) load(imgFile string) error {
+	img, err := LoadImage(imgFile, t.opts.Background)
+	if err != nil {
+		return err
+	}
+	t.bounds = image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy())
+	if t.source, err = newRaster(t.dir, t.bounds, 3); err != nil {
+		return err
+	}
+
+	lo, hi := uint8(255), uint8(0)
+	row := make([]byte, 3*t.bounds.Dx())
+	for y := 0; y < t.bounds.Dy(); y++ {
+		for x := 0; x < t.bounds.Dx(); x++ {
+			p := img.Pix[img.PixOffset(x, y):]
+			row[3*x], row[3*x+1], row[3*x+2] = p[2], p[1], p[0]
+			for _, v := range p[:3] {
+				if v < lo {
+					lo = v
+				}
+				if v > hi {
+					hi = v
+				}
+			}
+		}
+		if err := t.source.write(row, image.Rect(0, y, t.bounds.Dx(), y+1)); err != nil {
+			return err
+		}
+	}
+	// The source is scaled by 255 before being normalized, like in the Etf initialization.
+	t.norm.srcMin, t.norm.srcMax = 255*float64(lo), 255*float64(hi)
+	return nil
+}
+
+// run executes the CLD stages over all the tiles.
+func (t *tiler) run() (*TiledResult, error) {
+	var err error
+	if t.gray, err = newRaster(t.dir, t.bounds, 1); err != nil {
+		return nil, err
+	}
+	if t.flow, err = newRaster(t.dir, t.bounds, 12); err != nil {
+		return nil, err
+	}
+	if t.opts.TaperWidth > 0 {
+		if t.mag, err = newRaster(t.dir, t.bounds, 12); err != nil {
+			return nil, err
+		}
+	}
+	if t.fDog, err = newRaster(t.dir, t.bounds, 4); err != nil {
+		return nil, err
+	}
+	if t.result, err = newRaster(t.dir, t.bounds, 1); err != nil {
+		return nil, err
+	}
+
+	t.norm.magMin, t.norm.magMax = math.Inf(1), 0
+	if err := t.each("Gradient range ", sobelMargin, t.gradientRange); err != nil {
+		return nil, err
+	}
+	if err := t.each("Edge tangent flow ", t.margins.etf, t.edgeTangentFlow); err != nil {
+		return nil, err
+	}
+	for i := 0; i <= t.opts.FDogIteration; i++ {
+		if i > 0 {
+			if err := t.combine(); err != nil {
+				return nil, err
+			}
+		}
+		if err := t.flowDoG(); err != nil {
+			return nil, err
+		}
+	}
+	if t.margins.post > 0 {
+		if err := t.postProcess(); err != nil {
+			return nil, err
+		}
+	}
+	if t.opts.AntiAlias {
+		if err := t.antiAlias(); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &TiledResult{Width: t.bounds.Dx(), Height: t.bounds.Dy(), result: t.result}
+	t.result = nil
+	return res, nil
+}
+
+// gradientRange stores the grayscale tile and extends the gradient magnitude range with the tile values.
+func (t *tiler) gradientRange(tile, outer image.Rectangle) error {
+	src, err := t.source.readMat(outer, gocv.MatTypeCV8UC3)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	gray := gocv.NewMat()
+	defer gray.Close()
+	gocv.CvtColor(src, &gray, gocv.ColorBGRToGray)
+	if err := t.gray.writeMat(gray, tile, outer); err != nil {
+		return err
+	}
+
+	inner := tile.Sub(outer.Min)
+	if t.opts.GradientOperator != "" {
+		img, err := src.ToImage()
+		if err != nil {
+			return err
+		}
+		g := Gradient(img, t.opts.GradientOperator)
+		for y := inner.Min.Y; y < inner.Max.Y; y++ {
+			for x := inner.Min.X; x < inner.Max.X; x++ {
+				t.norm.magMax = math.Max(t.norm.magMax, g.Magnitude[y*g.Width+x])
+			}
+		}
+		return nil
+	}
+
+	etf := &Etf{norm: &t.norm, gradientMag: gocv.NewMat()}
+	defer etf.gradientMag.Close()
+	gradX, gradY := etf.sobel(src)
+	gradX.Close()
+	gradY.Close()
+
+	mag, err := etf.gradientMag.DataPtrFloat32()
+	if err != nil {
+		return err
+	}
+	for y := inner.Min.Y; y < inner.Max.Y; y++ {
+		for x := inner.Min.X; x < inner.Max.X; x++ {
+			for ch := 0; ch < 3; ch++ {
+				v := float64(mag[3*(y*outer.Dx()+x)+ch])
+				t.norm.magMin = math.Min(t.norm.magMin, v)
+				t.norm.magMax = math.Max(t.norm.magMax, v)
+			}
+		}
+	}
+	return nil
+}
+
+// edgeTangentFlow computes and refines the edge tangent flow of the tile.
+func (t *tiler) edgeTangentFlow(tile, outer image.Rectangle) error {
+	src, err := t.source.readMat(outer, gocv.MatTypeCV8UC3)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	etf := NewETF()
+	etf.Init(outer.Dy(), outer.Dx())
+	etf.SetGradientOperator(t.opts.GradientOperator)
+	etf.SetSeparable(t.opts.SeparableEtf)
+	etf.norm = &t.norm
+	if err := etf.InitFromMat(src, outer.Size()); err != nil {
+		return err
+	}
+	for i := 0; i < t.opts.EtfIteration; i++ {
+		etf.RefineEtf(t.opts.EtfKernel)
+	}
+
+	if t.mag != nil {
+		if err := t.mag.writeMat(etf.gradientMag, tile, outer); err != nil {
+			return err
+		}
+	}
+	return t.flow.writeMat(etf.flowField, tile, outer)
+}
+
+// flowDoG computes the flow DoG of all the tiles, then thresholds it using the range of the whole image.
+func (t *tiler) flowDoG() error {
+	lo, hi := math.Inf(1), math.Inf(-1)
+
+	err := t.each("FDoG ", t.margins.fDog, func(tile, outer image.Rectangle) error {
+		c, err := t.tileCld(outer, t.gray, nil)
+		if err != nil {
+			return err
+		}
+		defer c.close()
+
+		src := gocv.NewMat()
+		defer src.Close()
+		c.Image.ConvertTo(&src, gocv.MatTypeCV32F, 1.0/255.0)
+
+		c.gradientDoG(&src, &c.dog, c.Rho, c.SigmaC)
+		c.integrateFlow(&c.dog, &c.fDog, c.SigmaM)
+
+		fDog, err := c.fDog.DataPtrFloat32()
+		if err != nil {
+			return err
+		}
+		inner := tile.Sub(outer.Min)
+		for y := inner.Min.Y; y < inner.Max.Y; y++ {
+			for _, v := range fDog[y*outer.Dx()+inner.Min.X : y*outer.Dx()+inner.Max.X] {
+				lo, hi = math.Min(lo, float64(v)), math.Max(hi, float64(v))
+			}
+		}
+		return t.fDog.writeMat(c.fDog, tile, outer)
+	})
+	if err != nil {
+		return err
+	}
+
+	return t.each("Threshold ", 0, func(tile, outer image.Rectangle) error {
+		fDog, err := t.fDog.readMat(tile, gocv.MatTypeCV32F)
+		if err != nil {
+			return err
+		}
+		defer fDog.Close()
+		normalizeRange(&fDog, lo, hi)
+
+		c := &Cld{
+			result:  gocv.NewMatWithSize(tile.Dy(), tile.Dx(), gocv.MatTypeCV8UC1),
+			etf:     &Etf{},
+			Options: t.opts,
+		}
+		defer c.result.Close()
+		c.binaryThreshold(&fDog, &c.result, c.Tau)
+
+		return t.result.writeMat(c.result, tile, tile)
+	})
+}
+
+// combine darkens the grayscale image with the lines of the previous FDoG iteration.
+// The combined image is written into a new raster, since the neighbouring tiles still need the original values.
+func (t *tiler) combine() error {
+	gray, err := newRaster(t.dir, t.bounds, 1)
+	if err != nil {
+		return err
+	}
+	err = t.each("Combine ", t.margins.combine, func(tile, outer image.Rectangle) error {
+		c, err := t.tileCld(outer, t.gray, t.result)
+		if err != nil {
+			return err
+		}
+		defer c.close()
+
+		c.combineImage()
+		return gray.writeMat(c.Image, tile, outer)
+	})
+	if err != nil {
+		gray.close()
+		return err
+	}
+	t.gray.close()
+	t.gray = gray
+
+	return nil
+}
+
+// postProcess applies the tapering and the stroke weight on the line drawing.
+func (t *tiler) postProcess() error {
+	result, err := newRaster(t.dir, t.bounds, 1)
+	if err != nil {
+		return err
+	}
+	err = t.each("Post-processing ", t.margins.post, func(tile, outer image.Rectangle) error {
+		c, err := t.tileCld(outer, nil, t.result)
+		if err != nil {
+			return err
+		}
+		defer c.close()
+
+		c.strokes()
+		return result.writeMat(c.result, tile, outer)
+	})
+	if err != nil {
+		result.close()
+		return err
+	}
+	t.result.close()
+	t.result = result
+
+	return nil
+}
+
+// antiAlias normalizes the line drawing using the value range of the whole image, like PostProcessing.AntiAlias,
+// then blurs it. The range is computed in a separate pass, since normalizing by the range of a single tile
+// would blacken the tiles without any line.
+func (t *tiler) antiAlias() error {
+	lo, hi := 255, 0
+	err := t.each("Anti-aliasing range ", 0, func(tile, _ image.Rectangle) error {
+		data, err := t.result.read(tile)
+		if err != nil {
+			return err
+		}
+		for _, v := range data {
+			if int(v) < lo {
+				lo = int(v)
+			}
+			if int(v) > hi {
+				hi = int(v)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Like the min-max normalization of OpenCV, an image having a single value is mapped to black.
+	var lut [256]uint8
+	if hi > lo {
+		scale := 255 / float64(hi-lo)
+		for v := lo; v <= hi; v++ {
+			lut[v] = uint8(math.Round(float64(v-lo) * scale))
+		}
+	}
+
+	result, err := newRaster(t.dir, t.bounds, 1)
+	if err != nil {
+		return err
+	}
+	err = t.each("Anti-aliasing ", t.margins.antiAlias, func(tile, outer image.Rectangle) error {
+		data, err := t.result.read(outer)
+		if err != nil {
+			return err
+		}
+		for i, v := range data {
+			data[i] = lut[v]
+		}
+		lines := gocv.NewMatWithSize(outer.Dy(), outer.Dx(), gocv.MatTypeCV8UC1)
+		defer lines.Close()
+		copy(lines.DataPtrUint8(), data)
+
+		gocv.GaussianBlur(lines, &lines, image.Point{t.opts.BlurSize, t.opts.BlurSize}, 0.0, 0.0, gocv.BorderConstant)
+		return result.writeMat(lines, tile, outer)
+	})
+	if err != nil {
+		result.close()
+		return err
+	}
+	t.result.close()
+	t.result = result
+
+	return nil
+}
+
+// tileCld returns a Cld holding the region of the grayscale image, of the line drawing
+// and of the edge tangent flow covered by the outer rectangle of a tile.
+func (t *tiler) tileCld(outer image.Rectangle, gray, result *raster) (*Cld, error) {
+	rows, cols := outer.Dy(), outer.Dx()
+	c := &Cld{
+		Image:   gocv.NewMatWithSize(rows, cols, gocv.MatTypeCV8UC1),
+		result:  gocv.NewMatWithSize(rows, cols, gocv.MatTypeCV8UC1),
+		dog:     gocv.NewMatWithSize(rows, cols, gocv.MatTypeCV32F),
+		fDog:    gocv.NewMatWithSize(rows, cols, gocv.MatTypeCV32F),
+		etf:     NewETF(),
+		Options: t.opts,
+	}
+	var err error
+	if gray != nil {
+		c.Image.Close()
+		if c.Image, err = gray.readMat(outer, gocv.MatTypeCV8UC1); err != nil {
+			return nil, err
+		}
+	}
+	if result != nil {
+		c.result.Close()
+		if c.result, err = result.readMat(outer, gocv.MatTypeCV8UC1); err != nil {
+			return nil, err
+		}
+	}
+	if c.etf.flowField, err = t.flow.readMat(outer, gocv.MatTypeCV32F+gocv.MatChannels3); err != nil {
+		return nil, err
+	}
+	if t.mag == nil {
+		c.etf.gradientMag = gocv.NewMat()
+	} else if c.etf.gradientMag, err = t.mag.readMat(outer, gocv.MatTypeCV32F+gocv.MatChannels3); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// close releases the matrices of a tile Cld.
+func (c *Cld) close() {
+	c.Image.Close()
+	c.result.Close()
+	c.dog.Close()
+	c.fDog.Close()
+	c.etf.flowField.Close()
+	c.etf.gradientMag.Close()
+}
+
+// each calls the function for all the tiles covering the image, together with the tile expanded by the margin.
+func (t *tiler) each(msg string, margin int, fn func(tile, outer image.Rectangle) error) error {
+	tiles := t.tiles()
+
+	e := newEvent(msg)
+	e.start()
+	defer e.stop()
+
+	for i, tile := range tiles {
+		e.append(strconv.Itoa(i+1) + "/" + strconv.Itoa(len(tiles)))
+		if err := fn(tile, tile.Inset(-margin).Intersect(t.bounds)); err != nil {
+			return err
+		}
+		e.clear()
+	}
+	return nil
+}
+
+// tiles returns the tiles covering the image.
+func (t *tiler) tiles() []image.Rectangle {
+	var tiles []image.Rectangle
+	for y := 0; y < t.bounds.Dy(); y += t.tileSize {
+		for x := 0; x < t.bounds.Dx(); x += t.tileSize {
+			tiles = append(tiles, image.Rect(x, y, x+t.tileSize, y+t.tileSize).Intersect(t.bounds))
+		}
+	}
+	return tiles
+}
+
+// close removes the temporary rasters.
+func (t *tiler) close() {
+	for _, r := range []*raster{t.source, t.gray, t.flow, t.mag, t.fDog, t.result} {
+		if r != nil {
+			r.close()
+		}
+	}
+}
+
+// raster is a row-major image stored in a temporary file, read and written by rectangular regions.
+type raster struct {
+	file      *os.File
+	width     int
+	pixelSize int
+}
+
+// newRaster creates a zero filled raster covering the bounds, having the provided number of bytes per pixel.
+func newRaster(dir string, bounds image.Rectangle, pixelSize int) (*raster, error) {
+	f, err := ioutil.TempFile(dir, "colidr-tile-")
+	if err != nil {
+		return nil, err
+	}
+	r := &raster{file: f, width: bounds.Dx(), pixelSize: pixelSize}
+	if err := f.Truncate(int64(bounds.Dx()) * int64(bounds.Dy()) * int64(pixelSize)); err != nil {
+		r.close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// offset returns the file offset of the pixel.
+func (r *raster) offset(x, y int) int64 {
+	return (int64(y)*int64(r.width) + int64(x)) * int64(r.pixelSize)
+}
+
+// read returns the pixels of the rectangle.
+func (r *raster) read(rect image.Rectangle) ([]byte, error) {
+	stride := rect.Dx() * r.pixelSize
+	data := make([]byte, stride*rect.Dy())
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := data[(y-rect.Min.Y)*stride : (y-rect.Min.Y+1)*stride]
+		if _, err := r.file.ReadAt(row, r.offset(rect.Min.X, y)); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// write stores the pixels of the rectangle.
+func (r *raster) write(data []byte, rect image.Rectangle) error {
+	stride := rect.Dx() * r.pixelSize
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := data[(y-rect.Min.Y)*stride : (y-rect.Min.Y+1)*stride]
+		if _, err := r.file.WriteAt(row, r.offset(rect.Min.X, y)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readMat returns the pixels of the rectangle as a matrix of the provided type.
+// The pixels are copied into the matrix memory, since the matrix outlives the slice they are read into.
+func (r *raster) readMat(rect image.Rectangle, mt gocv.MatType) (gocv.Mat, error) {
+	data, err := r.read(rect)
+	if err != nil {
+		return gocv.Mat{}, err
+	}
+	m := gocv.NewMatWithSize(rect.Dy(), rect.Dx(), mt)
+	copy(m.DataPtrUint8(), data)
+	return m, nil
+}
+
+// writeMat stores the part of the matrix covering the outer rectangle which falls into the tile.
+func (r *raster) writeMat(m gocv.Mat, tile, outer image.Rectangle) error {
+	data := m.ToBytes()
+	stride := outer.Dx() * r.pixelSize
+	inner := tile.Sub(outer.Min)
+
+	rows := make([]byte, 0, tile.Dx()*tile.Dy()*r.pixelSize)
+	for y := inner.Min.Y; y < inner.Max.Y; y++ {
+		start := y*stride + inner.Min.X*r.pixelSize
+		rows = append(rows, data[start:start+tile.Dx()*r.pixelSize]...)
+	}
+	return r.write(rows, tile)
+}
+
+// close removes the raster file.
+func (r *raster) close() error {
+	r.file.Close()
+	return os.Remove(r.file.Name())
+}
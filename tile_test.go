@@ -0,0 +1,147 @@
+package colidr
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestRaster_ReadWrite(t *testing.T) {
+	bounds := image.Rect(0, 0, 10, 8)
+	r, err := newRaster("", bounds, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+
+	rect := image.Rect(3, 2, 7, 5)
+	data := make([]byte, 2*rect.Dx()*rect.Dy())
+	for i := range data {
+		data[i] = byte(i + 1)
+	}
+	if err := r.write(data, rect); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := r.read(rect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("expected %v, got %v", data, got)
+	}
+	// The pixels outside of the written rectangle are zero.
+	row, err := r.read(image.Rect(0, 2, 10, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row[0] != 0 || row[6] != data[0] || row[14] != 0 {
+		t.Errorf("unexpected row content: %v", row)
+	}
+}
+
+func TestTiler_Tiles(t *testing.T) {
+	tl := &tiler{bounds: image.Rect(0, 0, 50, 30), tileSize: 16}
+
+	covered := make(map[image.Point]int)
+	for _, tile := range tl.tiles() {
+		for y := tile.Min.Y; y < tile.Max.Y; y++ {
+			for x := tile.Min.X; x < tile.Max.X; x++ {
+				covered[image.Point{x, y}]++
+			}
+		}
+	}
+	if len(covered) != 50*30 {
+		t.Fatalf("expected the tiles to cover %d pixels, got %d", 50*30, len(covered))
+	}
+	for p, n := range covered {
+		if n != 1 {
+			t.Fatalf("expected the tiles not to overlap, pixel %v is covered %d times", p, n)
+		}
+	}
+}
+
+func TestGenerateTiled(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		opts    func(*Options)
+	}{
+		{"circle_default", "circle", func(*Options) {}},
+		{"circle_fdog_iteration", "circle", func(o *Options) { o.FDogIteration = 1 }},
+		{"stripes_kernel", "stripes", func(o *Options) { o.EtfKernel = 5; o.EtfIteration = 2 }},
+		{"circle_taper", "circle", func(o *Options) { o.TaperWidth = 3 }},
+		{"circle_stroke_weight", "circle", func(o *Options) { o.StrokeWeight = 1 }},
+		{"stripes_thin_stroke", "stripes", func(o *Options) { o.StrokeWeight = -1 }},
+		{"circle_anti_alias", "circle", func(o *Options) { o.AntiAlias = true }},
+		{"stripes_anti_alias_stroke", "stripes", func(o *Options) { o.AntiAlias = true; o.BlurSize = 5; o.StrokeWeight = 1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			tt.opts(&opts)
+
+			c, err := NewCLD(fixture(tt.fixture), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := c.GenerateCld()
+			expected := &image.Gray{
+				Pix:    data,
+				Stride: c.Image.Cols(),
+				Rect:   image.Rect(0, 0, c.Image.Cols(), c.Image.Rows()),
+			}
+
+			res, err := GenerateTiled(fixture(tt.fixture), opts, TileOptions{TileSize: 20})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Close()
+
+			got, err := res.Image()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := diffImages(got, expected); diff > diffTolerance {
+				t.Errorf("the tiled output differs from the whole image output in %.2f%% of the pixels", diff*100)
+			}
+		})
+	}
+}
+
+func TestGenerateTiled_UnsupportedOptions(t *testing.T) {
+	opts := testOptions()
+	opts.AutoTau = AutoTauOtsu
+	opts.MinComponentArea = 10
+
+	_, err := GenerateTiled(fixture("circle"), opts, TileOptions{TileSize: 20})
+	verr, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	if len(verr) != 2 {
+		t.Errorf("expected 2 field errors, got %d: %v", len(verr), verr)
+	}
+}
+
+func TestNewTiler_MemoryBudget(t *testing.T) {
+	opts := testOptions()
+	peak, err := loadPeak(fixture("circle"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newTiler(fixture("circle"), opts, TileOptions{MemoryBudget: peak}); err == nil {
+		t.Error("expected an error for a budget only covering the decoding of the image")
+	}
+
+	side := int64(40 + 2*opts.tileMargins().max())
+	tl, err := newTiler(fixture("circle"), opts, TileOptions{MemoryBudget: peak + tileBytesPerPixel*side*side})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tl.tileSize != 40 {
+		t.Errorf("expected the tile size 40 from the budget left after the decoding, got %d", tl.tileSize)
+	}
+}
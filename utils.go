@@ -1,6 +1,17 @@
 package colidr
 
-import "math"
+import (
+	"math"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// RandomSeed can be used as the seed of the noise textures to obtain a different output on each run.
+const RandomSeed = -1
+
+// defaultSeed is the seed of the noise textures used when no seed is provided, so the output is reproducible.
+const defaultSeed = 1
 
 // gauss computes the gaussian function of variance
 func gauss(x, mean, sigma float64) float64 {
@@ -48,3 +59,34 @@ func absInt(x int) int {
 	}
 	return x
 }
+
+// parallelRows splits the rows between the available CPUs
+// and calls fn concurrently for each [start, end) range of rows.
+func parallelRows(height int, fn func(start, end int)) {
+	var wg sync.WaitGroup
+	rows := (height + runtime.NumCPU() - 1) / runtime.NumCPU()
+
+	for start := 0; start < height; start += rows {
+		end := start + rows
+		if end > height {
+			end = height
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			fn(start, end)
+		}(start, end)
+	}
+	wg.Wait()
+}
+
+// noiseSeed returns the seed of a noise texture: the default seed if it's zero and a random seed if it's negative.
+func noiseSeed(seed int64) int64 {
+	switch {
+	case seed == 0:
+		return defaultSeed
+	case seed < 0:
+		return time.Now().UnixNano()
+	}
+	return seed
+}
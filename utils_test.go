@@ -0,0 +1,84 @@
+package colidr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGauss(t *testing.T) {
+	sigma := 1.0
+	expected := 1.0 / math.Sqrt(2*math.Pi)
+
+	if got := gauss(0, 0, sigma); math.Abs(got-expected) > 1e-9 {
+		t.Errorf("expected the gaussian peak to be %v, got %v", expected, got)
+	}
+	if gauss(1, 0, sigma) != gauss(-1, 0, sigma) {
+		t.Error("expected the gaussian function to be symmetric")
+	}
+}
+
+func TestMakeGaussianVector(t *testing.T) {
+	for _, sigma := range []float64{0.5, 1.0, 2.6, 3.0} {
+		gv := makeGaussianVector(sigma)
+
+		if len(gv) < 2 {
+			t.Fatalf("sigma %v: expected at least two gaussian values, got %d", sigma, len(gv))
+		}
+		if gv[0] != gauss(0, 0, sigma) {
+			t.Errorf("sigma %v: expected the first value to be the gaussian peak", sigma)
+		}
+		for i := 1; i < len(gv); i++ {
+			if gv[i] >= gv[i-1] {
+				t.Errorf("sigma %v: expected a strictly decreasing vector at index %d", sigma, i)
+			}
+		}
+		// The vector is cut once the values drop below the threshold.
+		if last := gv[len(gv)-1]; last >= 0.001 {
+			t.Errorf("sigma %v: expected the last value to be below the threshold, got %v", sigma, last)
+		}
+		if prev := gv[len(gv)-2]; len(gv) > 2 && prev < 0.001 {
+			t.Errorf("sigma %v: expected only the last value to be below the threshold", sigma)
+		}
+	}
+
+	if len(makeGaussianVector(1.0)) >= len(makeGaussianVector(3.0)) {
+		t.Error("expected a wider gaussian vector for a larger sigma")
+	}
+}
+
+func BenchmarkMakeGaussianVector(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		makeGaussianVector(3.0)
+	}
+}
+
+func TestGaussianCache(t *testing.T) {
+	// The global sigmas are not quantized, so the default SigmaR*SigmaC keeps its exact value.
+	sigma := 1.6 * 0.95
+	gv := gauCache.get(sigma)
+	if gv[0] != gauss(0, 0, sigma) {
+		t.Errorf("expected the gaussian vector of the exact sigma %v", sigma)
+	}
+	if gv := gauCache.get(minSigma); len(gv) < 2 || math.IsNaN(gv[0]) {
+		t.Errorf("expected a valid gaussian vector for the minimum sigma, got %v", gv)
+	}
+
+	if s := quantizeSigma(1.523); math.Abs(s-1.52) > 1e-9 {
+		t.Errorf("expected the map sigma to be quantized to 1.52, got %v", s)
+	}
+	if s := quantizeSigma(0.001); s != sigmaStep {
+		t.Errorf("expected the map sigma to be quantized to at least %v, got %v", sigmaStep, s)
+	}
+}
+
+func TestNoiseSeed(t *testing.T) {
+	if s := noiseSeed(0); s != defaultSeed {
+		t.Errorf("expected the default seed for a zero seed, got %v", s)
+	}
+	if s := noiseSeed(42); s != 42 {
+		t.Errorf("expected the provided seed, got %v", s)
+	}
+	if s := noiseSeed(RandomSeed); s <= 0 {
+		t.Errorf("expected a random positive seed, got %v", s)
+	}
+}
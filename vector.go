@@ -0,0 +1,105 @@
+package colidr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+)
+
+// Point is a point with floating point coordinates.
+type Point struct {
+	X, Y float64
+}
+
+// Polyline is a sequence of connected points.
+type Polyline []Point
+
+// drawPolyline rasterizes the polyline into the destination image.
+func drawPolyline(dst draw.Image, line Polyline, col color.Color) {
+	if len(line) == 1 {
+		dst.Set(int(math.Round(line[0].X)), int(math.Round(line[0].Y)), col)
+	}
+	for i := 1; i < len(line); i++ {
+		drawLine(dst, line[i-1], line[i], col)
+	}
+}
+
+// drawLine rasterizes a line segment using a digital differential analyzer.
+func drawLine(dst draw.Image, p0, p1 Point, col color.Color) {
+	dx, dy := p1.X-p0.X, p1.Y-p0.Y
+	steps := math.Max(math.Abs(dx), math.Abs(dy))
+	if steps < 1 {
+		steps = 1
+	}
+	for i := 0.0; i <= steps; i++ {
+		x := p0.X + dx*i/steps
+		y := p0.Y + dy*i/steps
+		dst.Set(int(math.Round(x)), int(math.Round(y)), col)
+	}
+}
+
+// renderPolylines draws the polylines over the background image.
+// If the background is nil, the polylines are drawn over a white background.
+func renderPolylines(width, height int, background image.Image, lines []Polyline, col color.Color) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	if background != nil {
+		draw.Draw(dst, dst.Bounds(), background, background.Bounds().Min, draw.Src)
+	} else {
+		draw.Draw(dst, dst.Bounds(), image.White, image.ZP, draw.Src)
+	}
+	for _, line := range lines {
+		drawPolyline(dst, line, col)
+	}
+	return dst
+}
+
+// encodeSVG writes the polylines as SVG paths. If a background image is provided,
+// it's embedded into the SVG document as a base64 encoded PNG image.
+func encodeSVG(w io.Writer, width, height int, background image.Image, lines []Polyline, stroke color.Color, strokeWidth float64) error {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(&buf, "<svg xmlns=\"http://www.w3.org/2000/svg\" version=\"1.1\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n",
+		width, height, width, height)
+
+	if background != nil {
+		var img bytes.Buffer
+		if err := png.Encode(&img, background); err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "<image width=\"%d\" height=\"%d\" href=\"data:image/png;base64,%s\"/>\n",
+			width, height, base64.StdEncoding.EncodeToString(img.Bytes()))
+	}
+
+	fmt.Fprintf(&buf, "<g fill=\"none\" stroke=\"%s\" stroke-width=\"%g\" stroke-linecap=\"round\" stroke-linejoin=\"round\">\n",
+		hexColor(stroke), strokeWidth)
+	for _, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		buf.WriteString("<polyline points=\"")
+		for i, p := range line {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			fmt.Fprintf(&buf, "%.2f,%.2f", p.X, p.Y)
+		}
+		buf.WriteString("\"/>\n")
+	}
+	buf.WriteString("</g>\n</svg>\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// hexColor returns the hexadecimal representation of a color.
+func hexColor(c color.Color) string {
+	nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x", nc.R, nc.G, nc.B)
+}
@@ -0,0 +1,268 @@
+package colidr
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// defaultVectorDPI is the resolution used for converting the pixels to points: one pixel is one point.
+const defaultVectorDPI = 72.0
+
+// pageSizes contains the supported page sizes in points, in portrait orientation.
+var pageSizes = map[string][2]float64{
+	"a3":     {842, 1191},
+	"a4":     {595, 842},
+	"a5":     {420, 595},
+	"letter": {612, 792},
+	"legal":  {612, 1008},
+}
+
+// VectorOptions contains the options of the vector output writers.
+type VectorOptions struct {
+	// Stroke is the line colour. If it's nil the lines are black.
+	Stroke color.Color
+	// Background is the page colour. If it's nil the page is transparent.
+	Background color.Color
+	// PageSize is one of a3, a4, a5, letter or legal. If it's empty the page fits the drawing.
+	// The page orientation follows the drawing and the drawing is scaled down if it doesn't fit into the page.
+	PageSize string
+	// DPI is the resolution of the drawing, defaults to 72.
+	DPI float64
+}
+
+// Vector holds the traced outlines of the line drawing.
+type Vector struct {
+	Width  int
+	Height int
+	Paths  []Polyline
+}
+
+// Vectorize traces the outlines of the line drawing, so it should be called after GenerateCld.
+// The outlines are simplified using the Douglas-Peucker algorithm with the provided tolerance (in pixels),
+// a zero tolerance keeping only the contour corners.
+func (c *Cld) Vectorize(tolerance float64) *Vector {
+	ink := gocv.NewMat()
+	defer ink.Close()
+	gocv.BitwiseNot(c.result, &ink)
+	// The anti-aliased or tapered result is not binary, so the faint halo around the lines is dropped.
+	gocv.Threshold(ink, &ink, 127, 255, gocv.ThresholdBinary)
+
+	contours := gocv.FindContours(ink, gocv.RetrievalList, gocv.ChainApproxSimple)
+
+	paths := make([]Polyline, 0, len(contours))
+	for _, contour := range contours {
+		if tolerance > 0 && len(contour) > 2 {
+			contour = gocv.ApproxPolyDP(contour, tolerance, true)
+		}
+		path := make(Polyline, len(contour))
+		for i, p := range contour {
+			path[i] = Point{X: float64(p.X) + 0.5, Y: float64(p.Y) + 0.5}
+		}
+		paths = append(paths, path)
+	}
+	return &Vector{
+		Width:  c.result.Cols(),
+		Height: c.result.Rows(),
+		Paths:  paths,
+	}
+}
+
+// vectorLayout describes the placement of the drawing on the page, all the values being in points.
+type vectorLayout struct {
+	width, height float64
+	scale         float64
+	offsetX       float64
+	offsetY       float64
+}
+
+// layout computes the page size and the drawing placement.
+func (v *Vector) layout(opts VectorOptions) (vectorLayout, error) {
+	dpi := opts.DPI
+	if dpi <= 0 {
+		dpi = defaultVectorDPI
+	}
+	scale := 72.0 / dpi
+	w, h := float64(v.Width)*scale, float64(v.Height)*scale
+
+	if opts.PageSize == "" {
+		return vectorLayout{width: w, height: h, scale: scale}, nil
+	}
+	size, ok := pageSizes[strings.ToLower(opts.PageSize)]
+	if !ok {
+		return vectorLayout{}, fmt.Errorf("unsupported page size: %v", opts.PageSize)
+	}
+	pw, ph := size[0], size[1]
+	if v.Width > v.Height {
+		pw, ph = ph, pw
+	}
+	if fit := math.Min(pw/w, ph/h); fit < 1 {
+		scale *= fit
+		w, h = w*fit, h*fit
+	}
+	return vectorLayout{
+		width:   pw,
+		height:  ph,
+		scale:   scale,
+		offsetX: (pw - w) / 2,
+		offsetY: (ph - h) / 2,
+	}, nil
+}
+
+// EncodeSVG writes the drawing in SVG format.
+func (v *Vector) EncodeSVG(w io.Writer, opts VectorOptions) error {
+	l, err := v.layout(opts)
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(w)
+
+	fmt.Fprintf(buf, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(buf, "<svg xmlns=\"http://www.w3.org/2000/svg\" version=\"1.1\" width=\"%gpt\" height=\"%gpt\" viewBox=\"0 0 %g %g\">\n",
+		l.width, l.height, l.width, l.height)
+	if opts.Background != nil {
+		fmt.Fprintf(buf, "<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", hexColor(opts.Background))
+	}
+	stroke := hexColor(strokeColor(opts))
+	fmt.Fprintf(buf, "<path transform=\"translate(%g %g) scale(%g)\" fill=\"%s\" fill-rule=\"evenodd\" stroke=\"%s\" stroke-width=\"1\" stroke-linejoin=\"round\" d=\"",
+		l.offsetX, l.offsetY, l.scale, stroke, stroke)
+	for _, path := range v.Paths {
+		for i, p := range path {
+			if i == 0 {
+				fmt.Fprintf(buf, "M%.2f %.2f", p.X, p.Y)
+			} else {
+				fmt.Fprintf(buf, "L%.2f %.2f", p.X, p.Y)
+			}
+		}
+		if len(path) > 0 {
+			buf.WriteString("Z")
+		}
+	}
+	buf.WriteString("\"/>\n</svg>\n")
+
+	return buf.Flush()
+}
+
+// EncodePDF writes the drawing as a single page PDF document.
+func (v *Vector) EncodePDF(w io.Writer, opts VectorOptions) error {
+	l, err := v.layout(opts)
+	if err != nil {
+		return err
+	}
+
+	var content bytes.Buffer
+	zw := zlib.NewWriter(&content)
+	v.writePaths(zw, l, opts, false)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Contents 4 0 R /Resources << >> >>", l.width, l.height),
+		fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", content.Len(), content.Bytes()),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// EncodeEPS writes the drawing in Encapsulated PostScript format.
+func (v *Vector) EncodeEPS(w io.Writer, opts VectorOptions) error {
+	l, err := v.layout(opts)
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(w)
+
+	fmt.Fprintf(buf, "%%!PS-Adobe-3.0 EPSF-3.0\n")
+	fmt.Fprintf(buf, "%%%%BoundingBox: 0 0 %d %d\n", int(math.Ceil(l.width)), int(math.Ceil(l.height)))
+	fmt.Fprintf(buf, "%%%%HiResBoundingBox: 0 0 %g %g\n", l.width, l.height)
+	fmt.Fprintf(buf, "%%%%Creator: colidr\n%%%%EndComments\n")
+	fmt.Fprintf(buf, "/m { moveto } bind def\n/l { lineto } bind def\n/h { closepath } bind def\n")
+	v.writePaths(buf, l, opts, true)
+	fmt.Fprintf(buf, "showpage\n%%%%EOF\n")
+
+	return buf.Flush()
+}
+
+// writePaths writes the page content using the path construction operators shared by PDF and PostScript.
+// The m, l and h PostScript procedures are defined in the EPS prolog.
+func (v *Vector) writePaths(w io.Writer, l vectorLayout, opts VectorOptions, postscript bool) {
+	if opts.Background != nil {
+		r, g, b := rgbComponents(opts.Background)
+		if postscript {
+			fmt.Fprintf(w, "%.3f %.3f %.3f setrgbcolor\n0 0 %g %g rectfill\n", r, g, b, l.width, l.height)
+		} else {
+			fmt.Fprintf(w, "%.3f %.3f %.3f rg\n0 0 %g %g re f\n", r, g, b, l.width, l.height)
+		}
+	}
+	r, g, b := rgbComponents(strokeColor(opts))
+
+	// Flip the vertical axis, because the image origin is the top left corner.
+	if postscript {
+		fmt.Fprintf(w, "gsave\n%g %g translate\n%g %g scale\n", l.offsetX, l.height-l.offsetY, l.scale, -l.scale)
+		fmt.Fprintf(w, "%.3f %.3f %.3f setrgbcolor\n1 setlinewidth\n1 setlinejoin\n", r, g, b)
+	} else {
+		fmt.Fprintf(w, "q\n%g 0 0 %g %g %g cm\n", l.scale, -l.scale, l.offsetX, l.height-l.offsetY)
+		fmt.Fprintf(w, "%.3f %.3f %.3f rg\n%.3f %.3f %.3f RG\n1 w\n1 j\n", r, g, b, r, g, b)
+	}
+
+	for _, path := range v.Paths {
+		if len(path) == 0 {
+			continue
+		}
+		for i, p := range path {
+			op := "l"
+			if i == 0 {
+				op = "m"
+			}
+			fmt.Fprintf(w, "%.2f %.2f %s\n", p.X, p.Y, op)
+		}
+		fmt.Fprintf(w, "h\n")
+	}
+
+	// The outlines are filled using the even-odd rule and stroked with a one pixel wide line,
+	// so that the one pixel wide lines, having degenerate outlines, are also visible.
+	if postscript {
+		fmt.Fprintf(w, "gsave eofill grestore stroke\ngrestore\n")
+	} else {
+		fmt.Fprintf(w, "B*\nQ\n")
+	}
+}
+
+// strokeColor returns the line colour, defaulting to black.
+func strokeColor(opts VectorOptions) color.Color {
+	if opts.Stroke == nil {
+		return color.Black
+	}
+	return opts.Stroke
+}
+
+// rgbComponents returns the color components in the [0, 1] range.
+func rgbComponents(c color.Color) (r, g, b float64) {
+	nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return float64(nc.R) / 255, float64(nc.G) / 255, float64(nc.B) / 255
+}
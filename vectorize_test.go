@@ -0,0 +1,111 @@
+package colidr
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestVector_Layout(t *testing.T) {
+	v := &Vector{Width: 1000, Height: 500}
+
+	tests := []struct {
+		opts     VectorOptions
+		expected vectorLayout
+	}{
+		{VectorOptions{}, vectorLayout{width: 1000, height: 500, scale: 1}},
+		{VectorOptions{DPI: 144}, vectorLayout{width: 500, height: 250, scale: 0.5}},
+		// The landscape drawing is scaled down to fit the landscape A4 page.
+		{VectorOptions{PageSize: "A4"}, vectorLayout{width: 842, height: 595, scale: 0.842, offsetY: 87}},
+	}
+	for _, tt := range tests {
+		l, err := v.layout(tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%.3f", []float64{l.width, l.height, l.scale, l.offsetX, l.offsetY}) !=
+			fmt.Sprintf("%.3f", []float64{tt.expected.width, tt.expected.height, tt.expected.scale, tt.expected.offsetX, tt.expected.offsetY}) {
+			t.Errorf("%+v: expected layout %+v, got %+v", tt.opts, tt.expected, l)
+		}
+	}
+	if _, err := v.layout(VectorOptions{PageSize: "b4"}); err == nil {
+		t.Error("expected an error for the unsupported page size")
+	}
+}
+
+func TestVector_Encode(t *testing.T) {
+	v := &Vector{
+		Width:  16,
+		Height: 16,
+		Paths:  []Polyline{{{2, 2}, {12, 2}, {12, 12}, {2, 12}}},
+	}
+	opts := VectorOptions{Stroke: color.NRGBA{R: 255, A: 255}, Background: color.White}
+
+	var buf bytes.Buffer
+	if err := v.EncodeSVG(&buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	if svg := buf.String(); !strings.Contains(svg, "M2.00 2.00L12.00 2.00L12.00 12.00L2.00 12.00Z") ||
+		!strings.Contains(svg, "stroke=\"#ff0000\"") {
+		t.Errorf("unexpected SVG output: %s", svg)
+	}
+
+	buf.Reset()
+	if err := v.EncodePDF(&buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.String()
+	if !strings.HasPrefix(pdf, "%PDF-1.4") || !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Fatal("expected a valid PDF header and trailer")
+	}
+	// The cross-reference table should point to the object definitions.
+	var offset int
+	xref := pdf[strings.Index(pdf, "xref\n"):]
+	if _, err := fmt.Sscanf(strings.Split(xref, "\n")[3], "%d", &offset); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(pdf[offset:], "1 0 obj") {
+		t.Errorf("expected the first object at offset %d", offset)
+	}
+
+	buf.Reset()
+	if err := v.EncodeEPS(&buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	if eps := buf.String(); !strings.Contains(eps, "%%BoundingBox: 0 0 16 16") || !strings.Contains(eps, "2.00 2.00 m") {
+		t.Errorf("unexpected EPS output: %s", eps)
+	}
+}
+
+func TestCld_VectorizeAntiAlias(t *testing.T) {
+	bounds := func(v *Vector) (min, max Point) {
+		min, max = Point{math.Inf(1), math.Inf(1)}, Point{math.Inf(-1), math.Inf(-1)}
+		for _, path := range v.Paths {
+			for _, p := range path {
+				min = Point{math.Min(min.X, p.X), math.Min(min.Y, p.Y)}
+				max = Point{math.Max(max.X, p.X), math.Max(max.Y, p.Y)}
+			}
+		}
+		return min, max
+	}
+
+	c := newTestCld(32, testOptions())
+	c.result.SetTo(gocv.NewScalar(255, 0, 0, 0))
+	for y := 8; y < 24; y++ {
+		for x := 8; x < 24; x++ {
+			c.result.SetUCharAt(y, x, 0)
+		}
+	}
+	expectedMin, expectedMax := bounds(c.Vectorize(0))
+
+	// The blurred halo of the anti-aliased lines should not be traced as ink.
+	NewPostProcessing(c.BlurSize).AntiAlias(c.result, c.result)
+	if min, max := bounds(c.Vectorize(0)); min != expectedMin || max != expectedMax {
+		t.Errorf("expected the outline bounds %v-%v, got %v-%v", expectedMin, expectedMax, min, max)
+	}
+}
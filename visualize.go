@@ -2,17 +2,35 @@ package colidr
 
 import (
 	"image"
-	"math"
+	"math/rand"
 
 	"gocv.io/x/gocv"
 )
 
+// The default edge tangent flow visualization values.
+const (
+	defaultVizNoiseScale = 2
+	defaultVizLength     = 10
+)
+
 // PostProcessing is a basic struct used for the post processing operations
 type PostProcessing struct {
-	Etf
 	blurSize int
 }
 
+// VizOptions contains the options of the edge tangent flow visualization.
+type VizOptions struct {
+	// Seed is the seed of the noise texture generator. The same seed produces the same visualization.
+	// If it's zero the default seed is used, while a negative seed, like RandomSeed, selects a random one.
+	Seed int64
+	// NoiseScale is the size in pixels of a noise texture cell.
+	NoiseScale int
+	// Length is the number of steps the LIC streamlines are followed in both directions.
+	Length int
+	// Spacing is the distance between the arrow glyphs and between the evenly spaced streamlines.
+	Spacing int
+}
+
 // NewPostProcessing is a constructor method which initialize the PostProcessing struct.
 func NewPostProcessing(blurSize int) *PostProcessing {
 	return &PostProcessing{
@@ -20,84 +38,54 @@ func NewPostProcessing(blurSize int) *PostProcessing {
 	}
 }
 
-// VizEtf visualize the edge tangent flow flowfield.
-func (pp *PostProcessing) VizEtf(flowField, dst *gocv.Mat) {
-	var (
-		it    = 10.0
-		sigma = 2.0 * it * it
-	)
-
-	noise := gocv.NewMatWithSize(flowField.Rows()/2, flowField.Cols()/2, gocv.MatTypeCV32F+gocv.MatChannels3)
-	gocv.Randu(&noise, 0.0, 1.0)
-	gocv.Resize(noise, &noise, image.Point{flowField.Cols(), flowField.Rows()}, 0, 0, gocv.InterpolationNearestNeighbor)
-
-	rows := noise.Rows()
-	cols := noise.Cols()
-
-	pp.wg.Add(rows * cols)
-	for i := 0; i < rows; i++ {
-		for j := 0; j < cols; j++ {
-			go func(i, j int) {
-				defer pp.wg.Done()
-
-				wSum := 0.0
-				x := float32(i)
-				y := float32(j)
-
-				for k := 0; k < int(it); k++ {
-					v := flowField.GetVecfAt((int(x)+rows)%rows, (int(y)+cols)%cols)
-					if v[0] != 0 {
-						x = x + (abs(v[0])/float32(abs(v[0])+abs(v[1])))*(abs(v[0])/v[0])
-					}
-					if v[1] != 0 {
-						y = y + (abs(v[1])/float32(abs(v[0])+abs(v[1])))*(abs(v[1])/v[1])
-					}
-					r2 := float32(k * k)
-					w := (1.0 / (math.Pi * sigma)) * math.Exp(-(float64(r2))/sigma)
-
-					xx := (int(x) + rows) % rows
-					yy := (int(y) + cols) % cols
-
-					dstAt := dst.GetFloatAt(i, j)
-					noiseAt := noise.GetFloatAt(xx, yy)
-					newVal := dstAt + (float32(w) * noiseAt)
-					wSum += w
-
-					dst.SetFloatAt(i, j, float32(newVal))
-				}
-
-				x = float32(i)
-				y = float32(j)
-				for k := 0; k < int(it); k++ {
-					v := flowField.GetVecfAt((int(x)+rows)%rows, (int(y)+cols)%cols)
-					if -v[0] != 0 {
-						x = x + (abs(-v[0])/float32(abs(-v[0])+abs(-v[1])))*(abs(-v[0])/-v[0])
-					}
-					if -v[1] != 0 {
-						y = y + (abs(-v[1])/float32(abs(-v[0])+abs(-v[1])))*(abs(-v[1])/-v[1])
-					}
-					r2 := float32(k * k)
-					w := (1.0 / (math.Pi * sigma)) * math.Exp(-(float64(r2))/sigma)
+// VizEtf visualize the edge tangent flow flowfield,
+// convolving a white noise texture along the flow with a gaussian LIC kernel.
+func (pp *PostProcessing) VizEtf(flowField, dst *gocv.Mat, opts VizOptions) error {
+	if opts.NoiseScale <= 0 {
+		opts.NoiseScale = defaultVizNoiseScale
+	}
+	if opts.Length <= 0 {
+		opts.Length = defaultVizLength
+	}
 
-					xx := (int(x) + rows) % rows
-					yy := (int(y) + cols) % cols
+	ff, err := NewFlowFieldFromMat(*flowField, nil)
+	if err != nil {
+		return err
+	}
+	noise := newNoise(ff.Width, ff.Height, opts.NoiseScale, noiseSeed(opts.Seed))
 
-					dstAt := dst.GetFloatAt(i, j)
-					noiseAt := noise.GetFloatAt(xx, yy)
-					newVal := dstAt + (float32(w) * noiseAt)
-					wSum += w
+	img, err := LIC(*ff, noise, LICOptions{Length: opts.Length, Kernel: LICGaussian})
+	if err != nil {
+		return err
+	}
+	dstData, err := dst.DataPtrFloat32()
+	if err != nil {
+		return err
+	}
+	for i := range dstData {
+		dstData[i] = float32(img.Pix[4*i]) / 255
+	}
+	return nil
+}
 
-					dst.SetFloatAt(i, j, float32(newVal))
-				}
+// newNoise generates a deterministic white noise texture for the provided seed.
+// Each noise value covers a scale x scale sized cell.
+func newNoise(width, height, scale int, seed int64) *image.Gray {
+	rnd := rand.New(rand.NewSource(seed))
+	cellRows, cellCols := (height+scale-1)/scale, (width+scale-1)/scale
 
-				dstAt := dst.GetFloatAt(i, j)
-				dstAt /= float32(wSum)
+	cells := make([]uint8, cellRows*cellCols)
+	for i := range cells {
+		cells[i] = uint8(rnd.Intn(256))
+	}
 
-				dst.SetFloatAt(i, j, dstAt)
-			}(i, j)
+	noise := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			noise.Pix[y*width+x] = cells[(y/scale)*cellCols+x/scale]
 		}
 	}
-	pp.wg.Wait()
+	return noise
 }
 
 // AntiAlias smooths out the destination matrix.
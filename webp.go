@@ -0,0 +1,424 @@
+package colidr
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+)
+
+// The VP8L bitstream constants.
+const (
+	vp8lSignature       = 0x2f
+	vp8lMaxSize         = 1 << 14
+	vp8lSubtractGreen   = 2
+	vp8lNumLengthCodes  = 24
+	vp8lNumDistCodes    = 40
+	vp8lMaxLength       = 4096
+	vp8lMinLength       = 3
+	vp8lMaxCodeLength   = 15
+	vp8lMaxCodeLenCodes = 7
+)
+
+// vp8lCodeLengthOrder is the order in which the code length code lengths are stored.
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// EncodeWebP writes the image in lossless WebP (VP8L) format.
+// The green channel is subtracted from the red and blue ones and the repeated pixels are encoded
+// as backward references to the left or to the above pixel, which suits well the line drawings.
+func EncodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxSize || height > vp8lMaxSize {
+		return fmt.Errorf("the WebP image size should be between 1 and %d pixels", vp8lMaxSize)
+	}
+
+	argb := make([]uint32, 0, width*height)
+	var alpha uint32
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			// Apply the subtract green transform.
+			r, bl := c.R-c.G, c.B-c.G
+			argb = append(argb, uint32(c.A)<<24|uint32(r)<<16|uint32(c.G)<<8|uint32(bl))
+			if c.A != 0xff {
+				alpha = 1
+			}
+		}
+	}
+	tokens := vp8lBackwardRefs(argb, width)
+
+	green := make([]int, 256+vp8lNumLengthCodes)
+	red := make([]int, 256)
+	blue := make([]int, 256)
+	alphas := make([]int, 256)
+	dist := make([]int, vp8lNumDistCodes)
+	for _, t := range tokens {
+		if t.length == 0 {
+			alphas[t.argb>>24]++
+			red[t.argb>>16&0xff]++
+			green[t.argb>>8&0xff]++
+			blue[t.argb&0xff]++
+			continue
+		}
+		lc, _, _ := vp8lPrefixEncode(t.length)
+		dc, _, _ := vp8lPrefixEncode(t.dist)
+		green[256+lc]++
+		dist[dc]++
+	}
+
+	bw := &vp8lBitWriter{}
+	bw.write(vp8lSignature, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	bw.write(alpha, 1)
+	bw.write(0, 3)
+
+	// Transform present: subtract green, followed by no other transform.
+	bw.write(1, 1)
+	bw.write(vp8lSubtractGreen, 2)
+	bw.write(0, 1)
+	// No color cache and no meta prefix codes.
+	bw.write(0, 1)
+	bw.write(0, 1)
+
+	codes := make([]vp8lHuffmanCode, 5)
+	for i, hist := range [][]int{green, red, blue, alphas, dist} {
+		codes[i] = bw.writeHuffmanCode(hist)
+	}
+	for _, t := range tokens {
+		if t.length == 0 {
+			codes[0].write(bw, int(t.argb>>8&0xff))
+			codes[1].write(bw, int(t.argb>>16&0xff))
+			codes[2].write(bw, int(t.argb&0xff))
+			codes[3].write(bw, int(t.argb>>24))
+			continue
+		}
+		lc, lbits, lextra := vp8lPrefixEncode(t.length)
+		codes[0].write(bw, 256+lc)
+		bw.write(lextra, lbits)
+
+		dc, dbits, dextra := vp8lPrefixEncode(t.dist)
+		codes[4].write(bw, dc)
+		bw.write(dextra, dbits)
+	}
+	data := bw.bytes()
+
+	pad := len(data) % 2
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+len(data)+pad))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if pad > 0 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// vp8lToken is either a literal pixel or a backward reference, in which case the length is not zero.
+// The distance is stored as a VP8L distance code.
+type vp8lToken struct {
+	argb   uint32
+	length int
+	dist   int
+}
+
+// vp8lBackwardRefs greedily replaces the runs of pixels identical to their left or above neighbours
+// with backward references.
+func vp8lBackwardRefs(argb []uint32, width int) []vp8lToken {
+	// The distance codes 1 and 2 are mapped to the above and to the left pixel.
+	refs := []struct{ offset, code int }{{width, 1}, {1, 2}}
+
+	tokens := make([]vp8lToken, 0, len(argb)/8)
+	for i := 0; i < len(argb); {
+		var best, bestCode int
+		for _, r := range refs {
+			if i < r.offset {
+				continue
+			}
+			n := 0
+			for i+n < len(argb) && n < vp8lMaxLength && argb[i+n] == argb[i+n-r.offset] {
+				n++
+			}
+			if n > best {
+				best, bestCode = n, r.code
+			}
+		}
+		if best >= vp8lMinLength {
+			tokens = append(tokens, vp8lToken{length: best, dist: bestCode})
+			i += best
+			continue
+		}
+		tokens = append(tokens, vp8lToken{argb: argb[i]})
+		i++
+	}
+	return tokens
+}
+
+// vp8lPrefixEncode returns the prefix code, the number of extra bits and the extra bits value of a length or distance.
+func vp8lPrefixEncode(v int) (code int, nbits uint, extra uint32) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	h := uint(bits.Len(uint(d)) - 1)
+	second := (d >> (h - 1)) & 1
+	nbits = h - 1
+	return int(2*h) + second, nbits, uint32(d & (1<<nbits - 1))
+}
+
+// vp8lBitWriter writes the bits starting with the least significant one.
+type vp8lBitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+// write writes the n lowest bits of the value.
+func (bw *vp8lBitWriter) write(v uint32, n uint) {
+	bw.acc |= uint64(v) << bw.nbits
+	bw.nbits += n
+	for bw.nbits >= 8 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc >>= 8
+		bw.nbits -= 8
+	}
+}
+
+// bytes flushes the pending bits and returns the written bytes.
+func (bw *vp8lBitWriter) bytes() []byte {
+	if bw.nbits > 0 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc, bw.nbits = 0, 0
+	}
+	return bw.buf
+}
+
+// vp8lHuffmanCode holds the canonical prefix code of each symbol, stored in reversed bit order.
+type vp8lHuffmanCode struct {
+	lengths []int
+	codes   []uint32
+}
+
+// write writes the code of the symbol.
+func (hc vp8lHuffmanCode) write(bw *vp8lBitWriter, sym int) {
+	bw.write(hc.codes[sym], uint(hc.lengths[sym]))
+}
+
+// writeHuffmanCode builds the prefix code of the histogram and writes its definition.
+// The codes of one or two symbols smaller than 256 are written using the simple code format.
+func (bw *vp8lBitWriter) writeHuffmanCode(hist []int) vp8lHuffmanCode {
+	var used []int
+	for sym, f := range hist {
+		if f > 0 {
+			used = append(used, sym)
+		}
+	}
+	if len(used) == 0 {
+		used = []int{0}
+	}
+
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		bw.write(1, 1)
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] <= 1 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+		lengths := make([]int, len(hist))
+		if len(used) == 2 {
+			bw.write(uint32(used[1]), 8)
+			lengths[used[0]], lengths[used[1]] = 1, 1
+		}
+		return newHuffmanCode(lengths)
+	}
+
+	lengths := huffmanLengths(ensureTwoSymbols(hist), vp8lMaxCodeLength)
+
+	// Encode the code lengths using the literal lengths and the zero run codes.
+	type clToken struct {
+		sym   int
+		nbits uint
+		extra uint32
+	}
+	var tokens []clToken
+	clHist := make([]int, len(vp8lCodeLengthOrder))
+	for i := 0; i < len(lengths); {
+		if lengths[i] != 0 {
+			tokens = append(tokens, clToken{sym: lengths[i]})
+			clHist[lengths[i]]++
+			i++
+			continue
+		}
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == 0 && run < 138 {
+			run++
+		}
+		switch {
+		case run >= 11:
+			tokens = append(tokens, clToken{18, 7, uint32(run - 11)})
+			clHist[18]++
+		case run >= 3:
+			tokens = append(tokens, clToken{17, 3, uint32(run - 3)})
+			clHist[17]++
+		default:
+			run = 1
+			tokens = append(tokens, clToken{sym: 0})
+			clHist[0]++
+		}
+		i += run
+	}
+	clCode := newHuffmanCode(huffmanLengths(ensureTwoSymbols(clHist), vp8lMaxCodeLenCodes))
+
+	numCodes := len(vp8lCodeLengthOrder)
+	for numCodes > 4 && clCode.lengths[vp8lCodeLengthOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+	bw.write(0, 1)
+	bw.write(uint32(numCodes-4), 4)
+	for _, sym := range vp8lCodeLengthOrder[:numCodes] {
+		bw.write(uint32(clCode.lengths[sym]), 3)
+	}
+	// All the code lengths are written, so the max symbol is not used.
+	bw.write(0, 1)
+	for _, t := range tokens {
+		clCode.write(bw, t.sym)
+		bw.write(t.extra, t.nbits)
+	}
+	return newHuffmanCode(lengths)
+}
+
+// ensureTwoSymbols returns a copy of the histogram having at least two used symbols,
+// because a complete prefix code can't be built from a single symbol.
+func ensureTwoSymbols(hist []int) []int {
+	h := make([]int, len(hist))
+	copy(h, hist)
+
+	used := 0
+	for _, f := range h {
+		if f > 0 {
+			used++
+		}
+	}
+	for sym := 0; used < 2 && sym < len(h); sym++ {
+		if h[sym] == 0 {
+			h[sym] = 1
+			used++
+		}
+	}
+	return h
+}
+
+// newHuffmanCode assigns the canonical prefix codes to the code lengths.
+func newHuffmanCode(lengths []int) vp8lHuffmanCode {
+	var count [vp8lMaxCodeLength + 1]int
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+
+	var next [vp8lMaxCodeLength + 2]uint32
+	code := uint32(0)
+	for l := 1; l <= vp8lMaxCodeLength; l++ {
+		code = (code + uint32(count[l-1])) << 1
+		next[l] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for sym, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		codes[sym] = bits.Reverse32(next[l]) >> uint(32-l)
+		next[l]++
+	}
+	return vp8lHuffmanCode{lengths: lengths, codes: codes}
+}
+
+// huffmanLengths computes the Huffman code lengths of the histogram, limited to the provided maximum length.
+// If the limit is exceeded, the frequencies are flattened and the code is rebuilt.
+func huffmanLengths(hist []int, maxLength int) []int {
+	freq := make([]int, len(hist))
+	copy(freq, hist)
+
+	for {
+		lengths := make([]int, len(freq))
+
+		// The leaves have no children and hold the symbol.
+		type node struct {
+			freq        int
+			left, right int
+			sym         int
+		}
+		var (
+			nodes  []node
+			active []int
+		)
+		for sym, f := range freq {
+			if f > 0 {
+				nodes = append(nodes, node{f, -1, -1, sym})
+				active = append(active, len(nodes)-1)
+			}
+		}
+		if len(active) < 2 {
+			for _, n := range nodes {
+				lengths[n.sym] = 1
+			}
+			return lengths
+		}
+		// Merge the two least frequent nodes until a single tree remains.
+		for len(active) > 1 {
+			var pair [2]int
+			for k := range pair {
+				lo := 0
+				for i := range active {
+					if nodes[active[i]].freq < nodes[active[lo]].freq {
+						lo = i
+					}
+				}
+				pair[k] = active[lo]
+				active = append(active[:lo], active[lo+1:]...)
+			}
+			nodes = append(nodes, node{nodes[pair[0]].freq + nodes[pair[1]].freq, pair[0], pair[1], -1})
+			active = append(active, len(nodes)-1)
+		}
+
+		maxDepth := 0
+		var walk func(n, depth int)
+		walk = func(n, depth int) {
+			if nodes[n].left < 0 {
+				lengths[nodes[n].sym] = depth
+				if depth > maxDepth {
+					maxDepth = depth
+				}
+				return
+			}
+			walk(nodes[n].left, depth+1)
+			walk(nodes[n].right, depth+1)
+		}
+		walk(active[0], 0)
+
+		if maxDepth <= maxLength {
+			return lengths
+		}
+		for i, f := range freq {
+			if f > 0 {
+				freq[i] = (f + 1) / 2
+			}
+		}
+	}
+}